@@ -0,0 +1,50 @@
+package HuntingHash
+
+//
+// Copyright 2025 (c) By Rick Wesson & Support Intelligence, Inc.
+// Licenced under the RLL 1.0
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	CLASSIFIER_LIBMAGIC  = "libmagic"
+	CLASSIFIER_SIGNATURE = "signature"
+)
+
+// TypeClassifier describes the type of a buffer, the description is hashed
+// into the identifier prefix so buffers described alike share a partition.
+// Implementations are safe for concurrent use.
+type TypeClassifier interface {
+	Classify(buffer []byte) (string, error)
+	Name() string
+	Close() error
+}
+
+// MagicStats describes the use of the pool of libmagic handles
+type MagicStats struct {
+	Handles  int           // in the pool
+	Lookups  uint64        // magic lookups made
+	Waits    uint64        // lookups that found every handle in use
+	WaitTime time.Duration // spent waiting for a handle, in total
+	MaxWait  time.Duration // longest single wait
+}
+
+// ClassifierNames lists the classifiers OpenClassifier accepts, the default first
+func ClassifierNames() []string {
+	return []string{CLASSIFIER_LIBMAGIC, CLASSIFIER_SIGNATURE}
+}
+
+// OpenClassifier opens the classifier called name, the empty name is
+// libmagic. handles sizes the libmagic pool.
+func OpenClassifier(name string, handles int) (TypeClassifier, error) {
+	switch name {
+	case "", CLASSIFIER_LIBMAGIC:
+		return NewLibmagicClassifier(handles)
+	case CLASSIFIER_SIGNATURE:
+		return NewSignatureClassifier(), nil
+	}
+	return nil, fmt.Errorf("unknown type classifier %q, use one of %v", name, ClassifierNames())
+}
@@ -0,0 +1,256 @@
+package HuntingHash
+
+//
+// Copyright 2025 (c) By Rick Wesson & Support Intelligence, Inc.
+// Licenced under the RLL 1.0
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/OneOfOne/xxhash"
+)
+
+const (
+	CLUSTER_COMPONENTS = "components"
+	CLUSTER_DBSCAN     = "dbscan"
+
+	// CLUSTER_MEDOID_SAMPLE bounds the identifiers a medoid candidate is
+	// measured against, larger clusters estimate their medoid from an evenly
+	// spaced sample of their identifiers
+	CLUSTER_MEDOID_SAMPLE = 256
+)
+
+// ClusterOptions controls how ClusterEntries groups identifiers
+type ClusterOptions struct {
+	Metric    Metric // HammingDistance when nil
+	Threshold int    // identifiers within Threshold are connected
+	Method    string // components or dbscan
+	MinPoints int    // dbscan: entries within Threshold, itself included, to be a core point
+}
+
+// Cluster is a group of similar identifiers sharing a prefix
+type Cluster struct {
+	ID      string // derived from the smallest member, independent of input order
+	Prefix  string
+	Medoid  Identifier // member with the smallest total distance to the others, or to a sample of them
+	Members []IndexEntry
+	Noise   bool // dbscan: a single entry that belongs to no cluster
+}
+
+// ClusterEntries groups entries by prefix, connects identifiers within the
+// threshold and returns the connected components or the dbscan clusters.
+// Clusters are sorted by prefix, then by decreasing size.
+func ClusterEntries(entries []IndexEntry, opts ClusterOptions) ([]Cluster, error) {
+	if opts.Metric == nil {
+		opts.Metric = HammingDistance
+	}
+	switch opts.Method {
+	case "":
+		opts.Method = CLUSTER_COMPONENTS
+	case CLUSTER_COMPONENTS:
+	case CLUSTER_DBSCAN:
+		if opts.MinPoints < 1 {
+			opts.MinPoints = 1
+		}
+	default:
+		return nil, fmt.Errorf("unknown cluster method %q, use %s or %s", opts.Method, CLUSTER_COMPONENTS, CLUSTER_DBSCAN)
+	}
+	if opts.Threshold < 0 {
+		return nil, fmt.Errorf("threshold must not be negative")
+	}
+
+	partitions := make(map[string][]IndexEntry)
+	for _, e := range entries {
+		partitions[e.Id.partition()] = append(partitions[e.Id.partition()], e)
+	}
+
+	var clusters []Cluster
+	for prefix, part := range partitions {
+		clusters = append(clusters, clusterPartition(prefix, part, opts)...)
+	}
+
+	sort.Slice(clusters, func(i, j int) bool {
+		a, b := clusters[i], clusters[j]
+		if a.Prefix != b.Prefix {
+			return a.Prefix < b.Prefix
+		}
+		if len(a.Members) != len(b.Members) {
+			return len(a.Members) > len(b.Members)
+		}
+		return a.ID < b.ID
+	})
+	return clusters, nil
+}
+
+// clusterPartition works on the distinct identifiers of a partition, entries
+// sharing an identifier always end up in the same cluster. The entries are
+// sorted first so the clusters, dbscan border points included, do not depend
+// on the order they came in.
+func clusterPartition(prefix string, entries []IndexEntry, opts ClusterOptions) []Cluster {
+	entries = append([]IndexEntry(nil), entries...)
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Id.voxel != b.Id.voxel {
+			return a.Id.voxel < b.Id.voxel
+		}
+		if a.Sha1 != b.Sha1 {
+			return a.Sha1 < b.Sha1
+		}
+		return a.Label < b.Label
+	})
+
+	var ids []Identifier
+	members := make(map[Identifier][]IndexEntry)
+	tree := &bkTree{metric: opts.Metric}
+	for _, e := range entries {
+		if _, ok := members[e.Id]; !ok {
+			ids = append(ids, e.Id)
+			tree.insert(IndexEntry{Id: e.Id})
+		}
+		members[e.Id] = append(members[e.Id], e)
+	}
+	pos := make(map[Identifier]int, len(ids))
+	for i, id := range ids {
+		pos[id] = i
+	}
+
+	neighbors := func(i int) []int {
+		var n []int
+		for _, nb := range tree.radius(ids[i], opts.Threshold) {
+			n = append(n, pos[nb.Id])
+		}
+		return n
+	}
+
+	// label[i] is the cluster of ids[i], -1 for dbscan noise
+	label := make([]int, len(ids))
+	groups := 0
+	if opts.Method == CLUSTER_DBSCAN {
+		groups = dbscan(ids, members, neighbors, opts.MinPoints, label)
+	} else {
+		groups = components(len(ids), neighbors, label)
+	}
+
+	grouped := make([][]Identifier, groups)
+	var clusters []Cluster
+	for i, id := range ids {
+		if label[i] < 0 {
+			clusters = append(clusters, newCluster(prefix, []Identifier{id}, members, opts.Metric, true))
+			continue
+		}
+		grouped[label[i]] = append(grouped[label[i]], id)
+	}
+	for _, g := range grouped {
+		clusters = append(clusters, newCluster(prefix, g, members, opts.Metric, false))
+	}
+	return clusters
+}
+
+func components(n int, neighbors func(int) []int, label []int) int {
+	parent := make([]int, n)
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+	for i := 0; i < n; i++ {
+		for _, j := range neighbors(i) {
+			if a, b := find(i), find(j); a != b {
+				parent[a] = b
+			}
+		}
+	}
+
+	roots := make(map[int]int)
+	for i := 0; i < n; i++ {
+		r := find(i)
+		if _, ok := roots[r]; !ok {
+			roots[r] = len(roots)
+		}
+		label[i] = roots[r]
+	}
+	return len(roots)
+}
+
+func dbscan(ids []Identifier, members map[Identifier][]IndexEntry, neighbors func(int) []int, minPoints int, label []int) int {
+	const unvisited = -2
+	for i := range label {
+		label[i] = unvisited
+	}
+
+	// a core point has at least minPoints entries within the threshold
+	core := func(nb []int) bool {
+		n := 0
+		for _, j := range nb {
+			n += len(members[ids[j]])
+		}
+		return n >= minPoints
+	}
+
+	groups := 0
+	for i := range ids {
+		if label[i] != unvisited {
+			continue
+		}
+		nb := neighbors(i)
+		if !core(nb) {
+			label[i] = -1
+			continue
+		}
+		label[i] = groups
+		queue := nb
+		for len(queue) > 0 {
+			j := queue[0]
+			queue = queue[1:]
+			if label[j] == -1 {
+				label[j] = groups // border point
+			}
+			if label[j] != unvisited {
+				continue
+			}
+			label[j] = groups
+			if jn := neighbors(j); core(jn) {
+				queue = append(queue, jn...)
+			}
+		}
+		groups++
+	}
+	return groups
+}
+
+func newCluster(prefix string, ids []Identifier, members map[Identifier][]IndexEntry, metric Metric, noise bool) Cluster {
+	sort.Slice(ids, func(i, j int) bool { return ids[i].voxel < ids[j].voxel })
+
+	c := Cluster{Prefix: prefix, Noise: noise}
+	c.ID = fmt.Sprintf("%s-%08x", prefix, xxhash.ChecksumString32(ids[0].String()))
+
+	// every identifier against every other is quadratic in the cluster size
+	sample := ids
+	if len(ids) > CLUSTER_MEDOID_SAMPLE {
+		sample = make([]Identifier, CLUSTER_MEDOID_SAMPLE)
+		for i := range sample {
+			sample[i] = ids[i*len(ids)/CLUSTER_MEDOID_SAMPLE]
+		}
+	}
+
+	best := -1
+	for _, a := range ids {
+		sum := 0
+		for _, b := range sample {
+			sum += metric(a, b) * len(members[b])
+		}
+		if best < 0 || sum < best {
+			best = sum
+			c.Medoid = a
+		}
+		c.Members = append(c.Members, members[a]...)
+	}
+	return c
+}
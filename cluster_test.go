@@ -0,0 +1,119 @@
+package HuntingHash
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// bitsIdentifier is an order 8 identifier whose voxel has the given bits set
+func bitsIdentifier(t *testing.T, magicHash uint32, bits ...int) Identifier {
+	t.Helper()
+
+	voxel := make([]byte, VOXEL_LEN)
+	for _, b := range bits {
+		voxel[b/8] |= 1 << (b % 8)
+	}
+	id, err := NewIdentifier(8, magicHash, voxel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// clusterFixture has two dense groups sharing a border point, an outlier
+// and, under another prefix, a group larger than the medoid sample
+func clusterFixture(t *testing.T) []IndexEntry {
+	t.Helper()
+
+	sets := [][]int{
+		{}, {8}, {9}, {8, 9}, // a core group
+		{2, 3, 4, 5}, {2, 3, 4, 5, 10}, {2, 3, 4, 5, 11}, {2, 3, 4, 5, 10, 11}, // another
+		{2, 3},                         // within the threshold of a point of each, a core point of neither
+		{100, 101, 102, 103, 104, 105}, // noise
+	}
+	var entries []IndexEntry
+	for i, bits := range sets {
+		id := bitsIdentifier(t, 1, bits...)
+		entries = append(entries, IndexEntry{Id: id, Sha1: fmt.Sprintf("small-%d", i)})
+		if i == 1 {
+			// entries sharing an identifier
+			entries = append(entries, IndexEntry{Id: id, Sha1: "small-dup", Label: "dup"})
+		}
+	}
+
+	r := rand.New(rand.NewSource(6))
+	seen := make(map[Identifier]bool)
+	for len(seen) < 2*CLUSTER_MEDOID_SAMPLE+50 {
+		id := bitsIdentifier(t, 2, r.Intn(128), r.Intn(128))
+		if !seen[id] {
+			seen[id] = true
+			entries = append(entries, IndexEntry{Id: id, Sha1: fmt.Sprintf("large-%d", len(seen))})
+		}
+	}
+	return entries
+}
+
+func TestClustersDoNotDependOnInputOrder(t *testing.T) {
+	entries := clusterFixture(t)
+	for _, opts := range []ClusterOptions{
+		{Method: CLUSTER_COMPONENTS, Threshold: 2},
+		{Method: CLUSTER_DBSCAN, Threshold: 2, MinPoints: 4},
+		{Method: CLUSTER_DBSCAN, Threshold: 4, MinPoints: 4, Metric: L1Distance},
+	} {
+		want, err := ClusterEntries(entries, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := rand.New(rand.NewSource(1))
+		for range 20 {
+			shuffled := append([]IndexEntry(nil), entries...)
+			r.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+			got, err := ClusterEntries(shuffled, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("%s threshold %d: clusters of shuffled entries differ", opts.Method, opts.Threshold)
+			}
+		}
+	}
+}
+
+func TestDBSCANBorderPoint(t *testing.T) {
+	clusters, err := ClusterEntries(clusterFixture(t)[:11], ClusterOptions{Method: CLUSTER_DBSCAN, Threshold: 2, MinPoints: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sizes []int
+	noise := 0
+	for _, c := range clusters {
+		if c.Noise {
+			noise++
+			continue
+		}
+		sizes = append(sizes, len(c.Members))
+	}
+	// the border point joins one group, it does not merge them
+	if !reflect.DeepEqual(sizes, []int{6, 4}) || noise != 1 {
+		t.Fatalf("cluster sizes %v and %d noise, want [6 4] and 1", sizes, noise)
+	}
+}
+
+func TestMedoid(t *testing.T) {
+	var entries []IndexEntry
+	for i, bits := range [][]int{{0}, {0, 1}, {0, 2}, {0, 3}, {1, 2, 3}} {
+		entries = append(entries, IndexEntry{Id: bitsIdentifier(t, 1, bits...), Sha1: fmt.Sprint(i)})
+	}
+	clusters, err := ClusterEntries(entries, ClusterOptions{Threshold: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clusters) != 1 {
+		t.Fatalf("%d clusters, want 1", len(clusters))
+	}
+	if want := entries[0].Id; clusters[0].Medoid != want {
+		t.Fatalf("medoid %s, want %s", clusters[0].Medoid, want)
+	}
+}
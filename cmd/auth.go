@@ -0,0 +1,443 @@
+package main
+
+//
+// Copyright 2025 (c) By Rick Wesson & Support Intelligence, Inc.
+// Licenced under the RLL 1.0
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	hh "github.com/wessorh/HuntingHash"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const TOKEN_PREFIX = "hh_" // generated tokens, tells them apart in logs and secrets scanners
+
+var (
+	tokenFile     string // serving: require a bearer token listed in this file
+	clientToken   string // client: bearer token sent with every request
+	tokenInsecure bool   // client: send the token over tcp without TLS
+)
+
+var (
+	errNoToken      = errors.New("a bearer token is required")
+	errUnknownToken = errors.New("unknown bearer token")
+)
+
+// limitError is a request refused by the limits of its token. tooLarge
+// refuses the request for good, the others succeed again after retry.
+type limitError struct {
+	msg      string
+	tooLarge bool
+	retry    time.Duration
+}
+
+func (e *limitError) Error() string { return e.msg }
+
+// apiToken is a line of the token file, the token itself is kept as its
+// SHA-256 only. The limits are off when zero.
+type apiToken struct {
+	name      string
+	rate      float64 // requests per second
+	burst     float64 // requests above rate accepted at once
+	maxBuffer int64   // bytes per buffer
+	daily     int64   // bytes per UTC day
+
+	mu     sync.Mutex
+	bucket float64 // requests available now
+	filled time.Time
+	day    string
+	used   int64 // bytes hashed on day
+}
+
+// tokenStore holds the tokens of -tokens by the SHA-256 of the token
+type tokenStore struct {
+	tokens map[[sha256.Size]byte]*apiToken
+}
+
+// loadTokens reads a token file: lines of a name, the sha256: of a token
+// and key=value limits, rate, burst, max-buffer and daily; # starts a
+// comment.
+//
+//	scanner1 sha256:5e88...d8 rate=10 burst=20 max-buffer=64M daily=20G
+func loadTokens(filename string) (*tokenStore, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ts := &tokenStore{tokens: make(map[[sha256.Size]byte]*apiToken)}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		t, hash, err := parseToken(fields)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", filename, n, err)
+		}
+		if _, dup := ts.tokens[hash]; dup {
+			return nil, fmt.Errorf("%s:%d: %s repeats a token", filename, n, t.name)
+		}
+		ts.tokens[hash] = t
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ts.tokens) == 0 {
+		return nil, fmt.Errorf("%s holds no tokens", filename)
+	}
+	return ts, nil
+}
+
+func parseToken(fields []string) (*apiToken, [sha256.Size]byte, error) {
+	var hash [sha256.Size]byte
+	if len(fields) < 2 {
+		return nil, hash, fmt.Errorf("want a name and the sha256: of a token")
+	}
+	t := &apiToken{name: fields[0]}
+
+	digest, ok := strings.CutPrefix(fields[1], "sha256:")
+	b, err := hex.DecodeString(digest)
+	if !ok || err != nil || len(b) != sha256.Size {
+		return nil, hash, fmt.Errorf("%s: %q is not sha256: and 64 hex digits", t.name, fields[1])
+	}
+	copy(hash[:], b)
+
+	for _, kv := range fields[2:] {
+		key, value, _ := strings.Cut(kv, "=")
+		var err error
+		switch key {
+		case "rate":
+			t.rate, err = strconv.ParseFloat(value, 64)
+		case "burst":
+			t.burst, err = strconv.ParseFloat(value, 64)
+		case "max-buffer":
+			t.maxBuffer, err = parseBytes(value)
+		case "daily":
+			t.daily, err = parseBytes(value)
+		default:
+			err = fmt.Errorf("unknown limit, use rate, burst, max-buffer or daily")
+		}
+		if err == nil && (t.rate < 0 || t.burst < 0 || t.maxBuffer < 0 || t.daily < 0) {
+			err = fmt.Errorf("negative limit")
+		}
+		if err != nil {
+			return nil, hash, fmt.Errorf("%s: %s: %w", t.name, kv, err)
+		}
+	}
+	if t.rate > 0 {
+		t.burst = max(t.burst, 1)
+		t.bucket = t.burst
+	}
+	return t, hash, nil
+}
+
+// parseBytes reads a byte count with an optional K, M, G or T, powers of 1024
+func parseBytes(s string) (int64, error) {
+	shift := 0
+	if len(s) > 0 {
+		switch s[len(s)-1] {
+		case 'K', 'k':
+			shift = 10
+		case 'M', 'm':
+			shift = 20
+		case 'G', 'g':
+			shift = 30
+		case 'T', 't':
+			shift = 40
+		}
+	}
+	if shift > 0 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if n > math.MaxInt64>>shift {
+		return 0, fmt.Errorf("too large")
+	}
+	return n << shift, nil
+}
+
+// authenticate returns the token of an Authorization header value
+func (ts *tokenStore) authenticate(authorization string) (*apiToken, error) {
+	scheme, token, _ := strings.Cut(strings.TrimSpace(authorization), " ")
+	token = strings.TrimSpace(token)
+	if !strings.EqualFold(scheme, "bearer") || len(token) == 0 {
+		return nil, errNoToken
+	}
+	t, ok := ts.tokens[sha256.Sum256([]byte(token))]
+	if !ok {
+		return nil, errUnknownToken
+	}
+	return t, nil
+}
+
+// allow takes a request from the token bucket
+func (t *apiToken) allow() error {
+	if t.rate == 0 {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if !t.filled.IsZero() {
+		t.bucket = min(t.burst, t.bucket+now.Sub(t.filled).Seconds()*t.rate)
+	}
+	t.filled = now
+	if t.bucket < 1 {
+		retry := time.Duration((1 - t.bucket) / t.rate * float64(time.Second))
+		return &limitError{msg: fmt.Sprintf("%s: rate limit of %g requests per second", t.name, t.rate), retry: retry}
+	}
+	t.bucket--
+	return nil
+}
+
+// admit charges bytes to the daily quota, total is the size of the buffer
+// they belong to, checked against max-buffer
+func (t *apiToken) admit(bytes, total int64) error {
+	if t.maxBuffer > 0 && total > t.maxBuffer {
+		return &limitError{msg: fmt.Sprintf("%s: buffer of %d bytes exceeds the limit of %d", t.name, total, t.maxBuffer), tooLarge: true}
+	}
+	if t.daily == 0 {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now().UTC()
+	if day := now.Format(time.DateOnly); day != t.day {
+		t.day, t.used = day, 0
+	}
+	if t.used+bytes > t.daily {
+		midnight := now.Truncate(24 * time.Hour).Add(24 * time.Hour)
+		return &limitError{msg: fmt.Sprintf("%s: daily quota of %d bytes exhausted", t.name, t.daily), retry: midnight.Sub(now)}
+	}
+	t.used += bytes
+	return nil
+}
+
+// admitRequest checks every buffer of a request against the limits of the
+// token the request came with, a BatchRequest is charged as a whole
+func admitRequest(ctx context.Context, req interface{}) error {
+	t, ok := ctx.Value(apiTokenKey{}).(*apiToken)
+	if !ok {
+		return nil
+	}
+	var buffers []int64
+	switch r := req.(type) {
+	case *hh.BufferRequest:
+		buffers = append(buffers, int64(len(r.Buffer)))
+	case *hh.SearchRequest:
+		buffers = append(buffers, int64(len(r.Buffer)))
+	case *hh.BatchRequest:
+		for _, b := range r.Requests {
+			buffers = append(buffers, int64(len(b.Buffer)))
+		}
+	}
+	var sum, largest int64
+	for _, n := range buffers {
+		sum += n
+		largest = max(largest, n)
+	}
+	return t.admit(sum, largest)
+}
+
+type apiTokenKey struct{}
+
+// authStatus is the gRPC status of an authentication or limit error
+func authStatus(err error) error {
+	var le *limitError
+	switch {
+	case errors.As(err, &le):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, errNoToken), errors.Is(err, errUnknownToken):
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	return err
+}
+
+// grpcAuthenticate checks the authorization metadata and the rate limit
+func (ts *tokenStore) grpcAuthenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var authorization string
+	if v := md.Get("authorization"); len(v) > 0 {
+		authorization = v[0]
+	}
+	t, err := ts.authenticate(authorization)
+	if err == nil {
+		err = t.allow()
+	}
+	if err != nil {
+		return ctx, authStatus(err)
+	}
+	return context.WithValue(ctx, apiTokenKey{}, t), nil
+}
+
+func (ts *tokenStore) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := ts.grpcAuthenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := admitRequest(ctx, req); err != nil {
+		return nil, authStatus(err)
+	}
+	return handler(ctx, req)
+}
+
+func (ts *tokenStore) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) error {
+	ctx, err := ts.grpcAuthenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &admittedStream{ServerStream: ss, ctx: ctx, token: ctx.Value(apiTokenKey{}).(*apiToken)})
+}
+
+// admittedStream charges each BufferChunk as it arrives, the buffer is
+// checked against max-buffer by the length the first chunk declares and by
+// the bytes received
+type admittedStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	token    *apiToken
+	length   int64
+	received int64
+}
+
+func (s *admittedStream) Context() context.Context { return s.ctx }
+
+func (s *admittedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	chunk, ok := m.(*hh.BufferChunk)
+	if !ok {
+		return nil
+	}
+	s.length = max(s.length, chunk.Length)
+	s.received += int64(len(chunk.Chunk))
+	if err := s.token.admit(int64(len(chunk.Chunk)), max(s.length, s.received)); err != nil {
+		return authStatus(err)
+	}
+	return nil
+}
+
+// REST_FORM_OVERHEAD is what the multipart encoding adds to the buffers of a
+// REST request, it is allowed on top of max-buffer
+const REST_FORM_OVERHEAD = 64 << 10
+
+// restAuthenticate wraps the REST API, requests without a listed bearer
+// token are refused with 401 and those over the rate limit with 429. The
+// body of a request is cut off past the max-buffer of its token, before
+// the form is parsed. The public paths need no token.
+func (ts *tokenStore) restAuthenticate(next http.Handler, public ...string) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if slices.Contains(public, r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		t, err := ts.authenticate(r.Header.Get("Authorization"))
+		if err == nil {
+			err = t.allow()
+		}
+		if err != nil {
+			restAuthError(w, err)
+			return
+		}
+		if t.maxBuffer > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, t.maxBuffer+REST_FORM_OVERHEAD)
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiTokenKey{}, t)))
+	}
+	return http.HandlerFunc(fn)
+}
+
+// restAuthError reports an authentication or limit error, a buffer or a
+// body over max-buffer is 413, the rate limit and the daily quota 429 with
+// the time to retry
+func restAuthError(w http.ResponseWriter, err error) {
+	var le *limitError
+	var mbe *http.MaxBytesError
+	switch {
+	case errors.As(err, &le) && le.tooLarge, errors.As(err, &mbe):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.As(err, &le):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(le.retry.Seconds()))))
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+	default:
+		w.Header().Set("WWW-Authenticate", `Bearer realm="hollomand"`)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	}
+	log.Debug().Msgf("rest: %v", err)
+}
+
+// restFormError reports a form that could not be parsed, 413 when the body
+// was cut off at max-buffer
+func restFormError(w http.ResponseWriter, err error) {
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		restAuthError(w, err)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
+// bearerToken sends the client token with every RPC
+type bearerToken struct {
+	token    string
+	insecure bool // the token may travel without TLS
+}
+
+// newBearerToken returns the credentials of token for address, they need
+// TLS unless address is a unix socket or -token-insecure is set
+func newBearerToken(token, address string) bearerToken {
+	_, unix := unixSocket(address)
+	return bearerToken{token: token, insecure: unix || tokenInsecure}
+}
+
+func (t bearerToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + t.token}, nil
+}
+
+func (t bearerToken) RequireTransportSecurity() bool { return !t.insecure }
+
+// newToken prints a random token and its line for the token file, the token
+// itself is shown this once
+func newToken(name string) error {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	token := TOKEN_PREFIX + base64.RawURLEncoding.EncodeToString(b)
+	hash := sha256.Sum256([]byte(token))
+	fmt.Printf("token: %s\n", token)
+	fmt.Printf("%s sha256:%s\n", name, hex.EncodeToString(hash[:]))
+	return nil
+}
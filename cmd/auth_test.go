@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	hh "github.com/wessorh/HuntingHash"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// tokenLine returns the token file line of token
+func tokenLine(name, token, limits string) string {
+	hash := sha256.Sum256([]byte(token))
+	return name + " sha256:" + hex.EncodeToString(hash[:]) + " " + limits + "\n"
+}
+
+func writeTokens(t *testing.T, lines ...string) *tokenStore {
+	t.Helper()
+
+	name := filepath.Join(t.TempDir(), "tokens")
+	content := "# test tokens\n\n"
+	for _, l := range lines {
+		content += l
+	}
+	if err := os.WriteFile(name, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ts, err := loadTokens(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts
+}
+
+func TestLoadTokens(t *testing.T) {
+	ts := writeTokens(t,
+		tokenLine("scanner1", "hh_one", "rate=10 burst=20 max-buffer=64M daily=20G # a comment"),
+		tokenLine("scanner2", "hh_two", ""))
+
+	one, err := ts.authenticate("Bearer hh_one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if one.name != "scanner1" || one.rate != 10 || one.burst != 20 || one.maxBuffer != 64<<20 || one.daily != 20<<30 {
+		t.Errorf("scanner1 limits %+v", one)
+	}
+	if two, err := ts.authenticate("bearer  hh_two "); err != nil || two.name != "scanner2" {
+		t.Errorf("scanner2: %v %v", two, err)
+	}
+	for _, header := range []string{"", "Bearer", "Basic hh_one", "hh_one"} {
+		if _, err := ts.authenticate(header); !errors.Is(err, errNoToken) {
+			t.Errorf("%q: %v, want %v", header, err, errNoToken)
+		}
+	}
+	if _, err := ts.authenticate("Bearer hh_three"); !errors.Is(err, errUnknownToken) {
+		t.Errorf("unknown token: %v", err)
+	}
+
+	for _, bad := range []string{
+		"scanner1\n",
+		"scanner1 5e88\n",
+		tokenLine("scanner1", "hh_one", "speed=10"),
+		tokenLine("scanner1", "hh_one", "rate=-1"),
+		tokenLine("scanner1", "hh_one", "daily=10X"),
+		tokenLine("scanner1", "hh_one", "") + tokenLine("scanner2", "hh_one", ""),
+		"# nothing\n",
+	} {
+		name := filepath.Join(t.TempDir(), "tokens")
+		os.WriteFile(name, []byte(bad), 0600)
+		if _, err := loadTokens(name); err == nil {
+			t.Errorf("token file %q accepted", bad)
+		}
+	}
+}
+
+func TestTokenRateLimit(t *testing.T) {
+	ts := writeTokens(t, tokenLine("scanner1", "hh_one", "rate=2 burst=3"))
+	token, _ := ts.authenticate("Bearer hh_one")
+
+	for i := 0; i < 3; i++ {
+		if err := token.allow(); err != nil {
+			t.Fatalf("request %d of the burst refused: %v", i, err)
+		}
+	}
+	err := token.allow()
+	var le *limitError
+	if !errors.As(err, &le) || le.tooLarge || le.retry <= 0 || le.retry > time.Second/2 {
+		t.Fatalf("request past the burst: %v", err)
+	}
+
+	// a second later the bucket holds two more requests
+	token.mu.Lock()
+	token.filled = token.filled.Add(-time.Second)
+	token.mu.Unlock()
+	for i := 0; i < 2; i++ {
+		if err := token.allow(); err != nil {
+			t.Fatalf("request %d after a second refused: %v", i, err)
+		}
+	}
+	if err := token.allow(); err == nil {
+		t.Fatal("bucket refilled past the rate")
+	}
+
+	// gRPC calls are refused with ResourceExhausted
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer hh_one"))
+	if _, err := ts.grpcAuthenticate(ctx); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("gRPC over the rate: %v", err)
+	}
+	if _, err := ts.grpcAuthenticate(context.Background()); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("gRPC without a token: %v", err)
+	}
+}
+
+func TestTokenMaxBuffer(t *testing.T) {
+	ts := writeTokens(t, tokenLine("scanner1", "hh_one", "max-buffer=10K"))
+	token, _ := ts.authenticate("Bearer hh_one")
+	ctx := context.WithValue(context.Background(), apiTokenKey{}, token)
+
+	small := &hh.BufferRequest{Buffer: make([]byte, 10<<10)}
+	large := &hh.BufferRequest{Buffer: make([]byte, 10<<10+1)}
+	if err := admitRequest(ctx, small); err != nil {
+		t.Errorf("buffer of max-buffer refused: %v", err)
+	}
+	var le *limitError
+	if err := admitRequest(ctx, large); !errors.As(err, &le) || !le.tooLarge {
+		t.Errorf("buffer over max-buffer: %v", err)
+	}
+	// max-buffer is per buffer, a batch of small buffers is admitted
+	if err := admitRequest(ctx, &hh.BatchRequest{Requests: []*hh.BufferRequest{small, small}}); err != nil {
+		t.Errorf("batch of small buffers refused: %v", err)
+	}
+	if err := admitRequest(ctx, &hh.BatchRequest{Requests: []*hh.BufferRequest{small, large}}); err == nil {
+		t.Error("batch holding a buffer over max-buffer admitted")
+	}
+
+	// REST bodies are cut off before the form is parsed
+	hs := newTestServer(t)
+	hs.tokens = ts
+	srv := httptest.NewServer(restHandler(hs))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		size int
+		code int
+	}{
+		{4 << 10, http.StatusOK},
+		{10<<10 + 1, http.StatusRequestEntityTooLarge},
+		{10<<10 + REST_FORM_OVERHEAD + 1, http.StatusRequestEntityTooLarge},
+	} {
+		for _, path := range []string{"/holloman/v2/hh128", "/holloman/v2/batch"} {
+			rsp, err := http.DefaultClient.Do(uploadRequest(t, srv.URL+path, "hh_one", randomBuffer(1, tc.size)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rsp.Body.Close()
+			if rsp.StatusCode != tc.code {
+				t.Errorf("%s: %d bytes got %d, want %d", path, tc.size, rsp.StatusCode, tc.code)
+			}
+		}
+	}
+}
+
+func TestTokenDailyQuota(t *testing.T) {
+	ts := writeTokens(t, tokenLine("scanner1", "hh_one", "daily=1K"))
+	token, _ := ts.authenticate("Bearer hh_one")
+
+	if err := token.admit(600, 600); err != nil {
+		t.Fatal(err)
+	}
+	if err := token.admit(424, 424); err != nil {
+		t.Fatalf("the last bytes of the quota refused: %v", err)
+	}
+	err := token.admit(1, 1)
+	var le *limitError
+	if !errors.As(err, &le) || le.tooLarge || le.retry <= 0 || le.retry > 24*time.Hour {
+		t.Fatalf("request past the quota: %v", err)
+	}
+
+	// the quota starts over on the next UTC day
+	token.mu.Lock()
+	token.day = "2001-01-01"
+	token.mu.Unlock()
+	if err := token.admit(1000, 1000); err != nil {
+		t.Errorf("quota did not start over: %v", err)
+	}
+
+	// REST answers 429 with the time to retry
+	rec := httptest.NewRecorder()
+	restAuthError(rec, token.admit(100, 100))
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("REST over the quota: %d, Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+}
+
+func TestBearerTokenNeedsTLS(t *testing.T) {
+	for _, tc := range []struct {
+		address  string
+		insecure bool
+		require  bool
+	}{
+		{"localhost:50051", false, true},
+		{"localhost:50051", true, false},
+		{"/run/hollomand.sock", false, false},
+		{"unix:hh.sock", false, false},
+	} {
+		tokenInsecure = tc.insecure
+		if got := newBearerToken("hh_one", tc.address).RequireTransportSecurity(); got != tc.require {
+			t.Errorf("%s, -token-insecure %v: RequireTransportSecurity %v", tc.address, tc.insecure, got)
+		}
+	}
+	tokenInsecure = false
+}
@@ -0,0 +1,147 @@
+package main
+
+//
+// Copyright 2025 (c) By Rick Wesson & Support Intelligence, Inc.
+// Licenced under the RLL 1.0
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	hh "github.com/wessorh/HuntingHash"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ClusterBatch clusters every buffer of the batch concurrently, a failing
+// buffer reports its error without failing the batch
+func (server *HollomanServer) ClusterBatch(ctx context.Context, req *hh.BatchRequest) (*hh.BatchResponse, error) {
+
+	if err := checkBatchLen(len(req.Requests)); err != nil {
+		return nil, err
+	}
+	rsp := &hh.BatchResponse{Results: make([]*hh.BatchResult, len(req.Requests))}
+
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(req.Requests) {
+		workers = len(req.Requests)
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				result := new(hh.BatchResult)
+				res, err := server.hash(req.Requests[i], false)
+				if err != nil {
+					st := status.Convert(err)
+					result.Error = st.Message()
+					result.Code = uint32(st.Code())
+				} else {
+					result.Response = toBufferResponse(res)
+				}
+				rsp.Results[i] = result
+			}
+		}()
+	}
+	for i := range req.Requests {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	return rsp, nil
+}
+
+// checkBatchLen refuses batches of more than -batch-max buffers
+func checkBatchLen(n int) error {
+	if n > batchMax {
+		return status.Errorf(codes.ResourceExhausted, "batch of %d buffers, -batch-max is %d", n, batchMax)
+	}
+	return nil
+}
+
+// restClusterBatch accepts up to -batch-max files in the holloman-data
+// field and returns the BatchResponse as JSON
+func restClusterBatch(hs *HollomanServer) http.Handler {
+
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			restFormError(w, err)
+			return
+		}
+		headers := r.MultipartForm.File["holloman-data"]
+		if err := checkBatchLen(len(headers)); err != nil {
+			http.Error(w, status.Convert(err).Message(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		breq := new(hh.BatchRequest)
+		for _, header := range headers {
+			file, err := header.Open()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			var buf bytes.Buffer
+			io.Copy(&buf, file)
+			file.Close()
+
+			name := strings.Split(header.Filename, ".")
+			breq.Requests = append(breq.Requests, &hh.BufferRequest{
+				Buffer:  buf.Bytes(),
+				Label:   name[0],
+				Pyramid: r.FormValue("pyramid") == "true",
+				Filter:  r.FormValue("filter"),
+			})
+		}
+		if len(breq.Requests) == 0 {
+			http.Error(w, "no holloman-data files in request", http.StatusBadRequest)
+			return
+		}
+
+		if err := admitRequest(r.Context(), breq); err != nil {
+			restAuthError(w, err)
+			return
+		}
+		resp, err := hs.ClusterBatch(r.Context(), breq)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		log.Debug().Msgf("/holloman/v2/batch %d buffers", len(breq.Requests))
+		js, err := json.Marshal(resp)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(js)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// ClusterBatch calls the ClusterBatch RPC
+func (c *HollomanClient) ClusterBatch(requests []*hh.BufferRequest) (*hh.BatchResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*60)
+	defer cancel()
+
+	return c.client.ClusterBatch(ctx, &hh.BatchRequest{Requests: requests})
+}
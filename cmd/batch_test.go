@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	hh "github.com/wessorh/HuntingHash"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// checkBatchResults compares every result with the request at its position,
+// want holds the identifier of a valid request or the code of a refused one
+func checkBatchResults(t *testing.T, rsp *hh.BatchResponse, want []interface{}) {
+	t.Helper()
+
+	if len(rsp.Results) != len(want) {
+		t.Fatalf("%d results for %d requests", len(rsp.Results), len(want))
+	}
+	for i, r := range rsp.Results {
+		switch w := want[i].(type) {
+		case string:
+			if r.Error != "" || r.Response == nil || r.Response.Id != w {
+				t.Errorf("result %d: %+v, want %s", i, r, w)
+			}
+		case codes.Code:
+			if r.Response != nil || r.Error == "" || codes.Code(r.Code) != w {
+				t.Errorf("result %d: %+v, want %s", i, r, w)
+			}
+		}
+	}
+}
+
+func TestClusterBatchKeepsRequestOrder(t *testing.T) {
+	hs := newTestServer(t)
+	valid, other := randomBuffer(1, 8<<10), randomBuffer(2, 8<<10)
+	short := randomBuffer(3, hh.BUFFER_LEN_MIN-1)
+	ids := make(map[string]string)
+	for name, b := range map[string][]byte{"valid": valid, "other": other} {
+		res, err := hs.hasher.HashBytes(b, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[name] = res.Id
+	}
+
+	client := startGRPC(t, hs)
+	rsp, err := client.ClusterBatch([]*hh.BufferRequest{
+		{Buffer: valid},
+		{Buffer: short},
+		{Buffer: other, Filter: "nope"},
+		{Buffer: other},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBatchResults(t, rsp, []interface{}{ids["valid"], codes.InvalidArgument, codes.InvalidArgument, ids["other"]})
+	// the message is the status message, not the formatted status
+	if msg := rsp.Results[1].Error; msg != status.Convert(hashError(hs, short)).Message() {
+		t.Errorf("error %q is not the status message", msg)
+	}
+
+	srv := httptest.NewServer(restHandler(hs))
+	defer srv.Close()
+	for _, tc := range []struct {
+		filter string
+		want   []interface{}
+	}{
+		{"", []interface{}{ids["valid"], codes.InvalidArgument, ids["other"]}},
+		// the filter of the form applies to every buffer
+		{"nope", []interface{}{codes.InvalidArgument, codes.InvalidArgument, codes.InvalidArgument}},
+	} {
+		req := uploadRequest(t, srv.URL+"/holloman/v2/batch", "", valid, short, other)
+		if tc.filter != "" {
+			q := req.URL.Query()
+			q.Set("filter", tc.filter)
+			req.URL.RawQuery = q.Encode()
+		}
+		hrsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rsp hh.BatchResponse
+		err = json.NewDecoder(hrsp.Body).Decode(&rsp)
+		hrsp.Body.Close()
+		if hrsp.StatusCode != http.StatusOK || err != nil {
+			t.Fatalf("filter %q: status %d, %v", tc.filter, hrsp.StatusCode, err)
+		}
+		checkBatchResults(t, &rsp, tc.want)
+	}
+}
+
+// hashError is the error hs reports for b
+func hashError(hs *HollomanServer, b []byte) error {
+	_, err := hs.hash(&hh.BufferRequest{Buffer: b}, false)
+	return err
+}
+
+func TestClusterBatchMax(t *testing.T) {
+	hs := newTestServer(t)
+	defer func(n int) { batchMax = n }(batchMax)
+	batchMax = 2
+
+	buffers := [][]byte{randomBuffer(1, 4<<10), randomBuffer(2, 4<<10), randomBuffer(3, 4<<10)}
+	client := startGRPC(t, hs)
+	var requests []*hh.BufferRequest
+	for _, b := range buffers {
+		requests = append(requests, &hh.BufferRequest{Buffer: b})
+	}
+	if _, err := client.ClusterBatch(requests); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("batch over -batch-max: %v", err)
+	}
+	if _, err := client.ClusterBatch(requests[:2]); err != nil {
+		t.Errorf("batch of -batch-max buffers: %v", err)
+	}
+
+	srv := httptest.NewServer(restHandler(hs))
+	defer srv.Close()
+	for n, code := range map[int]int{3: http.StatusRequestEntityTooLarge, 2: http.StatusOK} {
+		rsp, err := http.DefaultClient.Do(uploadRequest(t, srv.URL+"/holloman/v2/batch", "", buffers[:n]...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rsp.Body.Close()
+		if rsp.StatusCode != code {
+			t.Errorf("%d buffers: status %d, want %d", n, rsp.StatusCode, code)
+		}
+	}
+}
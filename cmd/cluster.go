@@ -0,0 +1,221 @@
+package main
+
+//
+// Copyright 2025 (c) By Rick Wesson & Support Intelligence, Inc.
+// Licenced under the RLL 1.0
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	hh "github.com/wessorh/HuntingHash"
+)
+
+// clusterCommand implements: hollomand [flags] cluster [cluster flags] [file ...]
+// The files, or stdin, hold one identifier per line, optionally with a label
+// and SHA-1 such as the output of stand alone and client modes.
+func clusterCommand(args []string) {
+	fset := flag.NewFlagSet("cluster", flag.ExitOnError)
+	threshold := fset.Int("threshold", 8, "maximum distance between connected identifiers")
+	metricName := fset.String("metric", metric, "distance: hamming or l1")
+	method := fset.String("method", hh.CLUSTER_COMPONENTS, "components or dbscan")
+	minPoints := fset.Int("min-points", 3, "dbscan: identifiers within threshold for a core point")
+	hashDir := fset.String("d", "", "hash every file in directory instead of reading identifiers")
+	fset.Parse(args)
+
+	m, err := metricByName(*metricName)
+	if err != nil {
+		log.Fatal().Msg(err.Error())
+	}
+
+	var entries []hh.IndexEntry
+	if len(*hashDir) > 0 {
+		entries, err = hashDirectoryEntries(*hashDir)
+	} else if fset.NArg() == 0 {
+		entries, err = readIdentifiers(os.Stdin, "-")
+	} else {
+		for _, name := range fset.Args() {
+			var e []hh.IndexEntry
+			e, err = readIdentifierFile(name)
+			if err != nil {
+				break
+			}
+			entries = append(entries, e...)
+		}
+	}
+	if err != nil {
+		log.Fatal().Msg(err.Error())
+	}
+
+	clusters, err := hh.ClusterEntries(entries, hh.ClusterOptions{
+		Metric:    m,
+		Threshold: *threshold,
+		Method:    *method,
+		MinPoints: *minPoints,
+	})
+	if err != nil {
+		log.Fatal().Msg(err.Error())
+	}
+	log.Debug().Msgf("%d identifiers in %d clusters", len(entries), len(clusters))
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	writeClusters(w, clusters, outputFormat)
+}
+
+// clusterColumns head the tsv and csv cluster output
+var clusterColumns = []string{"cluster", "size", "medoid", "label", "id", "sha1"}
+
+// writeClusters writes a row per member in format, text and tsv are the
+// same
+func writeClusters(w io.Writer, clusters []hh.Cluster, format string) {
+	cw := csv.NewWriter(w)
+	enc := json.NewEncoder(w)
+	switch format {
+	case FORMAT_TEXT, FORMAT_TSV:
+		fmt.Fprintln(w, strings.Join(clusterColumns, "\t"))
+	case FORMAT_CSV:
+		cw.Write(clusterColumns)
+	}
+	for _, c := range clusters {
+		id := c.ID
+		if c.Noise {
+			id = "noise"
+		}
+		for _, e := range c.Members {
+			switch format {
+			case FORMAT_CSV:
+				cw.Write([]string{id, strconv.Itoa(len(c.Members)), c.Medoid.String(), e.Label, e.Id.String(), e.Sha1})
+			case FORMAT_JSONL:
+				enc.Encode(struct {
+					Cluster                 string
+					Size                    int
+					Medoid, Label, Id, Sha1 string
+				}{id, len(c.Members), c.Medoid.String(), e.Label, e.Id.String(), e.Sha1})
+			case FORMAT_ID:
+				fmt.Fprintf(w, "%s %s\n", id, e.Id)
+			default:
+				fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\n", id, len(c.Members), c.Medoid, e.Label, e.Id, e.Sha1)
+			}
+		}
+	}
+	cw.Flush()
+}
+
+func readIdentifierFile(name string) ([]hh.IndexEntry, error) {
+	if name == "-" {
+		return readIdentifiers(os.Stdin, name)
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return readIdentifiers(file, name)
+}
+
+// readIdentifiers accepts lines holding an identifier and optionally a label
+// before it and a 40 character SHA-1, blank lines and # comments are skipped.
+// Every -format hollomand writes can be read back.
+func readIdentifiers(r io.Reader, name string) (entries []hh.IndexEntry, err error) {
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || text[0] == '#' {
+			continue
+		}
+
+		var e hh.IndexEntry
+		found := false
+		for i, field := range identifierFields(text) {
+			if id, err := hh.ParseIdentifier(field); err == nil && !found {
+				e.Id = id
+				found = true
+			} else if i == 0 {
+				e.Label = field
+			} else if len(field) == 40 && len(e.Sha1) == 0 {
+				e.Sha1 = field
+			}
+		}
+		if !found {
+			log.Debug().Msgf("%s:%d: no identifier", name, line)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// hashDirectoryEntries hashes every regular file below dir
+func hashDirectoryEntries(dir string) (entries []hh.IndexEntry, err error) {
+	curve, err := loadCurve()
+	if err != nil {
+		return nil, err
+	}
+	hasher, err := newHasher(curve, false)
+	if err != nil {
+		return nil, err
+	}
+	defer hasher.Close()
+	hasher.Filter, err = hh.ParseResampleFilter(filterName)
+	if err != nil {
+		return nil, err
+	}
+
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			log.Error().Msg(err.Error())
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		res, err := hasher.HashFile(path)
+		if err != nil {
+			log.Debug().Msgf("%s: %v", path, err)
+			return nil
+		}
+		id, err := res.Identifier()
+		if err != nil {
+			return err
+		}
+		entries = append(entries, hh.IndexEntry{Id: id, Label: path, Sha1: res.Sha1})
+		return nil
+	})
+	return entries, err
+}
+
+// identifierFields splits a line of any -format output into fields, the
+// label, when there is one, first
+func identifierFields(text string) []string {
+	switch {
+	case text[0] == '{':
+		var rec struct{ Path, Label, Id, Id2, Id8, Id16, Sha1 string }
+		if json.Unmarshal([]byte(text), &rec) != nil {
+			return nil
+		}
+		if len(rec.Path) == 0 {
+			rec.Path = rec.Label
+		}
+		return []string{rec.Path, rec.Id, rec.Sha1}
+	case strings.Contains(text, "\t"):
+		return strings.Split(text, "\t")
+	case strings.Contains(text, ","):
+		if fields, err := csv.NewReader(strings.NewReader(text)).Read(); err == nil {
+			return fields
+		}
+	}
+	return strings.Fields(text)
+}
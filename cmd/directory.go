@@ -0,0 +1,219 @@
+package main
+
+//
+// Copyright 2025 (c) By Rick Wesson & Support Intelligence, Inc.
+// Licenced under the RLL 1.0
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/rs/zerolog/log"
+	hh "github.com/wessorh/HuntingHash"
+)
+
+const (
+	SYMLINKS_SKIP   = "skip"   // ignore symbolic links
+	SYMLINKS_FILES  = "files"  // hash the files links point at, never enter linked directories
+	SYMLINKS_FOLLOW = "follow" // follow links to files and directories, each directory once
+)
+
+// stringList is a flag that may be repeated and holds comma separated values
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			if _, err := filepath.Match(v, ""); err != nil {
+				return fmt.Errorf("%q: %w", v, err)
+			}
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// dirOptions select the files -d hashes
+type dirOptions struct {
+	workers  int
+	include  stringList // globs a file must match one of, any file when empty
+	exclude  stringList // globs of files and directories to leave out
+	minSize  int64
+	maxSize  int64 // no limit when 0
+	symlinks string
+}
+
+var dirOpts dirOptions
+
+// matches reports whether a glob matches the base name or the path relative
+// to the directory being hashed
+func matches(globs []string, rel string) bool {
+	base := filepath.Base(rel)
+	for _, g := range globs {
+		if ok, _ := filepath.Match(g, base); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(g, rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// dirFile is a file found below the directory
+type dirFile struct {
+	path string
+	size int64
+}
+
+// dirWalker finds the files below root that the options select
+type dirWalker struct {
+	opts    dirOptions
+	root    string
+	files   chan<- dirFile
+	visited map[[2]uint64]bool // directories entered, by device and inode
+	skipped int
+}
+
+func (w *dirWalker) walk(dir string) {
+	if w.opts.symlinks == SYMLINKS_FOLLOW {
+		st, err := os.Stat(dir)
+		if err != nil {
+			log.Error().Msg(err.Error())
+			return
+		}
+		if sys, ok := st.Sys().(*syscall.Stat_t); ok {
+			id := [2]uint64{uint64(sys.Dev), uint64(sys.Ino)}
+			if w.visited[id] {
+				log.Debug().Msgf("%s: already visited", dir)
+				return
+			}
+			w.visited[id] = true
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Error().Msg(err.Error())
+		return
+	}
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		rel, _ := filepath.Rel(w.root, path)
+		if matches(w.opts.exclude, rel) {
+			w.skipped++
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil {
+			log.Error().Msg(err.Error())
+			continue
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			if w.opts.symlinks == SYMLINKS_SKIP {
+				w.skipped++
+				continue
+			}
+			if info, err = os.Stat(path); err != nil {
+				log.Error().Msgf("%s: %v", path, err)
+				continue
+			}
+			if info.IsDir() && w.opts.symlinks != SYMLINKS_FOLLOW {
+				w.skipped++
+				continue
+			}
+		}
+
+		switch {
+		case info.IsDir():
+			w.walk(path)
+		case !info.Mode().IsRegular():
+			w.skipped++
+		case len(w.opts.include) > 0 && !matches(w.opts.include, rel):
+			w.skipped++
+		case info.Size() < w.opts.minSize || (w.opts.maxSize > 0 && info.Size() > w.opts.maxSize):
+			w.skipped++
+		default:
+			w.files <- dirFile{path: path, size: info.Size()}
+		}
+	}
+}
+
+// dirResult is the result of a file, the object written by FORMAT_JSONL
+type dirResult struct {
+	*hh.BufferResponse
+	Path  string
+	Error string `json:",omitempty"`
+}
+
+// hashFunc hashes a file locally or through the server
+type hashFunc func(f dirFile) (*hh.BufferResponse, error)
+
+// lineFunc formats the result of a file for plain output
+type lineFunc func(path string, rsp *hh.BufferResponse) string
+
+// processDirectory hashes every file below dir selected by opts with a pool of
+// workers, files that could not be hashed are reported and fail the run
+func processDirectory(dir string, opts dirOptions, hash hashFunc, line lineFunc) error {
+
+	switch opts.symlinks {
+	case SYMLINKS_SKIP, SYMLINKS_FILES, SYMLINKS_FOLLOW:
+	default:
+		return fmt.Errorf("unknown symlink policy %q, use %s, %s or %s", opts.symlinks, SYMLINKS_SKIP, SYMLINKS_FILES, SYMLINKS_FOLLOW)
+	}
+	if st, err := os.Stat(dir); err != nil {
+		return err
+	} else if !st.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	files := make(chan dirFile)
+	results := make(chan dirResult)
+
+	var wg sync.WaitGroup
+	for w := 0; w < max(opts.workers, 1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range files {
+				rsp, err := hash(f)
+				res := dirResult{BufferResponse: rsp, Path: f.path}
+				if err != nil {
+					res.Error = err.Error()
+				}
+				results <- res
+			}
+		}()
+	}
+
+	walker := &dirWalker{opts: opts, root: dir, files: files, visited: make(map[[2]uint64]bool)}
+	go func() {
+		walker.walk(dir)
+		close(files)
+		wg.Wait()
+		close(results)
+	}()
+
+	var hashed, failed int
+	out := newResultWriter(os.Stdout, outputFormat, line, true)
+	for res := range results {
+		if len(res.Error) > 0 {
+			failed++
+		} else {
+			hashed++
+		}
+		out.write(res)
+	}
+	log.Debug().Msgf("%s: %d files hashed, %d failed, %d skipped", dir, hashed, failed, walker.skipped)
+	if failed > 0 {
+		return fmt.Errorf("%s: %d of %d files failed", dir, failed, hashed+failed)
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/rs/zerolog"
+	hh "github.com/wessorh/HuntingHash"
+)
+
+// writeTree creates files below root, the names are slash separated paths
+// and the values their sizes
+func writeTree(t *testing.T, root string, files map[string]int) {
+	t.Helper()
+
+	for name, size := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// walkTree returns the files below root opts selects, relative to root, and
+// the number skipped
+func walkTree(t *testing.T, root string, opts dirOptions) ([]string, int) {
+	t.Helper()
+
+	// dangling links are logged as errors
+	defer zerolog.SetGlobalLevel(zerolog.GlobalLevel())
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	files := make(chan dirFile)
+	w := &dirWalker{opts: opts, root: root, files: files, visited: make(map[[2]uint64]bool)}
+	go func() {
+		w.walk(root)
+		close(files)
+	}()
+	var found []string
+	for f := range files {
+		rel, err := filepath.Rel(root, f.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st, err := os.Stat(f.path); err != nil || st.Size() != f.size {
+			t.Fatalf("%s reported as %d bytes", rel, f.size)
+		}
+		found = append(found, filepath.ToSlash(rel))
+	}
+	sort.Strings(found)
+	return found, w.skipped
+}
+
+func TestDirectoryWalkFilters(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]int{
+		"a.exe":             100,
+		"b.txt":             100,
+		"small.exe":         10,
+		"large.exe":         5000,
+		"sub/c.exe":         100,
+		"sub/deep/d.exe":    100,
+		"vendor/e.exe":      100,
+		"sub/vendor/f.exe":  100,
+		"sub/deep/skip.exe": 100,
+	})
+	if err := syscall.Mkfifo(filepath.Join(root, "pipe.exe"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		opts    dirOptions
+		want    []string
+		skipped int
+	}{
+		{
+			"everything",
+			dirOptions{symlinks: SYMLINKS_SKIP},
+			[]string{"a.exe", "b.txt", "large.exe", "small.exe", "sub/c.exe", "sub/deep/d.exe", "sub/deep/skip.exe", "sub/vendor/f.exe", "vendor/e.exe"},
+			1, // the fifo
+		},
+		{
+			"include by base name",
+			dirOptions{symlinks: SYMLINKS_SKIP, include: stringList{"*.txt"}},
+			[]string{"b.txt"},
+			9,
+		},
+		{
+			"exclude directories and a relative path",
+			dirOptions{symlinks: SYMLINKS_SKIP, include: stringList{"*.exe"}, exclude: stringList{"vendor", "sub/deep/skip.exe"}},
+			[]string{"a.exe", "large.exe", "small.exe", "sub/c.exe", "sub/deep/d.exe"},
+			5, // b.txt, the fifo, both vendor directories and skip.exe
+		},
+		{
+			"sizes",
+			dirOptions{symlinks: SYMLINKS_SKIP, minSize: 50, maxSize: 1000, exclude: stringList{"sub", "vendor"}},
+			[]string{"a.exe", "b.txt"},
+			5,
+		},
+	} {
+		got, skipped := walkTree(t, root, tc.opts)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: found %v, want %v", tc.name, got, tc.want)
+		}
+		if skipped != tc.skipped {
+			t.Errorf("%s: %d skipped, want %d", tc.name, skipped, tc.skipped)
+		}
+	}
+}
+
+func TestDirectoryWalkSymlinks(t *testing.T) {
+	root, outside := t.TempDir(), t.TempDir()
+	writeTree(t, root, map[string]int{"a": 100, "dir/b": 100})
+	writeTree(t, outside, map[string]int{"c": 100})
+	for link, target := range map[string]string{
+		"link-a":      filepath.Join(root, "a"),
+		"link-out":    outside,
+		"dir/loop":    root,
+		"dangling":    filepath.Join(root, "missing"),
+		"link-c":      filepath.Join(outside, "c"),
+		"dir/link-up": filepath.Join(root, "dir"),
+	} {
+		if err := os.Symlink(target, filepath.Join(root, filepath.FromSlash(link))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		symlinks string
+		want     []string
+	}{
+		{SYMLINKS_SKIP, []string{"a", "dir/b"}},
+		{SYMLINKS_FILES, []string{"a", "dir/b", "link-a", "link-c"}},
+		// every directory is entered once, the links back into the tree are not followed again
+		{SYMLINKS_FOLLOW, []string{"a", "dir/b", "link-a", "link-c", "link-out/c"}},
+	} {
+		got, _ := walkTree(t, root, dirOptions{symlinks: tc.symlinks})
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("-symlinks %s: found %v, want %v", tc.symlinks, got, tc.want)
+		}
+	}
+}
+
+func TestProcessDirectoryChecksItsArguments(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	writeTree(t, dir, map[string]int{"file": 1})
+	for _, tc := range []struct {
+		dir, symlinks string
+	}{
+		{dir, "sometimes"},
+		{file, SYMLINKS_SKIP},
+		{filepath.Join(dir, "missing"), SYMLINKS_SKIP},
+	} {
+		if err := processDirectory(tc.dir, dirOptions{symlinks: tc.symlinks}, nil, nil); err == nil {
+			t.Errorf("processDirectory(%s, -symlinks %s) did not fail", tc.dir, tc.symlinks)
+		}
+	}
+}
+
+func TestProcessDirectoryFailsWithItsFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]int{"a.bin": 100, "b.bin": 100, "bad.bin": 100})
+	// results are written to stdout
+	defer func(f *os.File) { os.Stdout = f }(os.Stdout)
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	os.Stdout = devNull
+
+	hash := func(f dirFile) (*hh.BufferResponse, error) {
+		if filepath.Base(f.path) == "bad.bin" {
+			return nil, errors.New("cannot hash")
+		}
+		return &hh.BufferResponse{Id: "id"}, nil
+	}
+	line := func(path string, rsp *hh.BufferResponse) string { return path }
+
+	opts := dirOptions{symlinks: SYMLINKS_SKIP, workers: 2}
+	err = processDirectory(dir, opts, hash, line)
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 files failed") {
+		t.Errorf("a failed file gives %v", err)
+	}
+	opts.exclude = stringList{"bad.bin"}
+	if err := processDirectory(dir, opts, hash, line); err != nil {
+		t.Errorf("no failed file gives %v", err)
+	}
+}
+
+func TestStringList(t *testing.T) {
+	var l stringList
+	for _, v := range []string{"*.exe, *.dll", "bin/*", " ,"} {
+		if err := l.Set(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := (stringList{"*.exe", "*.dll", "bin/*"}); !reflect.DeepEqual(l, want) {
+		t.Fatalf("%v, want %v", l, want)
+	}
+	if err := l.Set("[a-"); err == nil {
+		t.Fatal("a malformed glob was accepted")
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+//
+// Copyright 2025 (c) By Rick Wesson & Support Intelligence, Inc.
+// Licenced under the RLL 1.0
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	hh "github.com/wessorh/HuntingHash"
+)
+
+const (
+	FORMAT_TEXT  = "text"  // the line each mode has always printed
+	FORMAT_TSV   = "tsv"   // tab separated, with a header
+	FORMAT_CSV   = "csv"   // comma separated, with a header
+	FORMAT_JSONL = "jsonl" // one JSON object per line
+	FORMAT_ID    = "id"    // the identifiers only
+)
+
+var outputFormat string
+
+// resultColumns head the tsv and csv output. New fields are added at the end
+// so parsers reading columns by position keep working.
+var resultColumns = []string{
+	"Path", "Id", "HOrder", "Len", "Magic", "NormalizedMagic", "Sha1",
+	"Ssdeep", "Tlsh", "Sdhash", "Id2", "Id8", "Id16", "Error",
+}
+
+func checkFormat(format string) error {
+	switch format {
+	case FORMAT_TEXT, FORMAT_TSV, FORMAT_CSV, FORMAT_JSONL, FORMAT_ID:
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q, use %s, %s, %s, %s or %s",
+		format, FORMAT_TEXT, FORMAT_TSV, FORMAT_CSV, FORMAT_JSONL, FORMAT_ID)
+}
+
+// resultRecord is the tsv and csv row of res
+func resultRecord(res dirResult) []string {
+	rsp := res.BufferResponse
+	if rsp == nil {
+		rsp = new(hh.BufferResponse)
+	}
+	return []string{
+		res.Path, rsp.Id, strconv.Itoa(int(rsp.HOrder)), strconv.Itoa(int(rsp.Len)),
+		rsp.Magic, rsp.NormalizedMagic, rsp.Sha1, rsp.Ssdeep, rsp.Tlsh, rsp.Sdhash,
+		rsp.Id2, rsp.Id8, rsp.Id16, res.Error,
+	}
+}
+
+// tsvField keeps tabs and line breaks inside a field from splitting the row
+var tsvField = strings.NewReplacer("\t", " ", "\r", " ", "\n", " ")
+
+// resultWriter writes each result in the output format, the header before
+// the first one when header is set
+type resultWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format string
+	line   lineFunc // formats FORMAT_TEXT
+	header bool
+}
+
+func newResultWriter(w io.Writer, format string, line lineFunc, header bool) *resultWriter {
+	return &resultWriter{w: w, format: format, line: line, header: header}
+}
+
+// write reports res, the text and id formats log failures rather than
+// writing them
+func (rw *resultWriter) write(res dirResult) error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	switch rw.format {
+	case FORMAT_JSONL:
+		return json.NewEncoder(rw.w).Encode(res)
+
+	case FORMAT_TSV:
+		if rw.header {
+			rw.header = false
+			if _, err := fmt.Fprintln(rw.w, strings.Join(resultColumns, "\t")); err != nil {
+				return err
+			}
+		}
+		record := resultRecord(res)
+		for i := range record {
+			record[i] = tsvField.Replace(record[i])
+		}
+		_, err := fmt.Fprintln(rw.w, strings.Join(record, "\t"))
+		return err
+
+	case FORMAT_CSV:
+		cw := csv.NewWriter(rw.w)
+		if rw.header {
+			rw.header = false
+			cw.Write(resultColumns)
+		}
+		cw.Write(resultRecord(res))
+		cw.Flush()
+		return cw.Error()
+	}
+
+	if len(res.Error) > 0 {
+		log.Error().Msgf("%s: %s", res.Path, res.Error)
+		return nil
+	}
+	if rw.format == FORMAT_ID {
+		ids := []string{res.Id}
+		for _, id := range []string{res.Id2, res.Id8, res.Id16} {
+			if len(id) > 0 {
+				ids = append(ids, id)
+			}
+		}
+		_, err := fmt.Fprintln(rw.w, strings.Join(ids, " "))
+		return err
+	}
+	_, err := fmt.Fprintln(rw.w, rw.line(res.Path, res.BufferResponse))
+	return err
+}
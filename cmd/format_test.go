@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+	hh "github.com/wessorh/HuntingHash"
+)
+
+// formatResults are a plain result, one with a pyramid and awkward
+// characters and a failure
+var formatResults = []dirResult{
+	{Path: "/bin/ls", BufferResponse: &hh.BufferResponse{
+		Id: "j362e4894.23655e5f5a6264630807270e00000000", HOrder: 9, Len: 142312,
+		Magic: "ELF 64-bit LSB pie executable", NormalizedMagic: "ELF 64-bit LSB pie executable", Sha1: "aa",
+	}},
+	{Path: "/tmp/odd, \"name\"\tx", BufferResponse: &hh.BufferResponse{
+		Id: "e00000001.0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f", HOrder: 4, Len: 300,
+		Magic: "text,\twith\nbreaks", Id2: "e00000001.x2.0f0f0f0f", Id8: "e00000001.x8.00", Id16: "e00000001.x16.00",
+	}},
+	{Path: "/tmp/unreadable", Error: "permission denied"},
+}
+
+func writeResults(t *testing.T, format string, header bool) string {
+	t.Helper()
+
+	defer zerolog.SetGlobalLevel(zerolog.GlobalLevel())
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	var buf bytes.Buffer
+	line := func(path string, rsp *hh.BufferResponse) string { return "text " + path + " " + rsp.Id }
+	w := newResultWriter(&buf, format, line, header)
+	for _, res := range formatResults {
+		if err := w.write(res); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.String()
+}
+
+func TestFormatCSV(t *testing.T) {
+	rows, err := csv.NewReader(strings.NewReader(writeResults(t, FORMAT_CSV, true))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1+len(formatResults) || !reflect.DeepEqual(rows[0], resultColumns) {
+		t.Fatalf("%d rows headed %v", len(rows), rows[0])
+	}
+	for i, res := range formatResults {
+		if want := resultRecord(res); !reflect.DeepEqual(rows[i+1], want) {
+			t.Fatalf("row %d is %q, want %q", i, rows[i+1], want)
+		}
+	}
+	if rows[3][len(resultColumns)-1] != "permission denied" {
+		t.Fatalf("the error column holds %q", rows[3][len(resultColumns)-1])
+	}
+
+	// appending to a file that has a header already
+	if out := writeResults(t, FORMAT_CSV, false); strings.HasPrefix(out, "Path,") {
+		t.Fatal("the header was written again")
+	}
+}
+
+func TestFormatTSV(t *testing.T) {
+	lines := strings.Split(strings.TrimSuffix(writeResults(t, FORMAT_TSV, true), "\n"), "\n")
+	if len(lines) != 1+len(formatResults) || lines[0] != strings.Join(resultColumns, "\t") {
+		t.Fatalf("%d lines headed %q", len(lines), lines[0])
+	}
+	for i, l := range lines[1:] {
+		fields := strings.Split(l, "\t")
+		if len(fields) != len(resultColumns) {
+			t.Fatalf("row %d has %d fields, want %d: %q", i, len(fields), len(resultColumns), l)
+		}
+		if fields[0] != strings.ReplaceAll(formatResults[i].Path, "\t", " ") {
+			t.Fatalf("row %d path %q", i, fields[0])
+		}
+	}
+	if got := strings.Split(lines[2], "\t")[4]; got != "text, with breaks" {
+		t.Fatalf("magic %q, tabs and breaks are not replaced", got)
+	}
+}
+
+func TestFormatJSONL(t *testing.T) {
+	lines := strings.Split(strings.TrimSuffix(writeResults(t, FORMAT_JSONL, true), "\n"), "\n")
+	if len(lines) != len(formatResults) {
+		t.Fatalf("%d lines, want %d", len(lines), len(formatResults))
+	}
+	for i, l := range lines {
+		var got dirResult
+		if err := json.Unmarshal([]byte(l), &got); err != nil {
+			t.Fatal(err)
+		}
+		want := formatResults[i]
+		if got.Path != want.Path || got.Error != want.Error {
+			t.Fatalf("line %d: %q", i, l)
+		}
+		if want.BufferResponse != nil && (got.BufferResponse == nil || got.Id != want.Id || got.Magic != want.Magic || got.Id16 != want.Id16) {
+			t.Fatalf("line %d: %q", i, l)
+		}
+	}
+	if strings.Contains(lines[0], `"Error"`) {
+		t.Fatalf("an empty error is written: %s", lines[0])
+	}
+}
+
+func TestFormatIDAndText(t *testing.T) {
+	want := "j362e4894.23655e5f5a6264630807270e00000000\n" +
+		"e00000001.0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f e00000001.x2.0f0f0f0f e00000001.x8.00 e00000001.x16.00\n"
+	if got := writeResults(t, FORMAT_ID, true); got != want {
+		t.Fatalf("id output\n%s\nwant\n%s", got, want)
+	}
+
+	// failures are logged, not written
+	want = "text /bin/ls j362e4894.23655e5f5a6264630807270e00000000\n" +
+		"text /tmp/odd, \"name\"\tx e00000001.0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f\n"
+	if got := writeResults(t, FORMAT_TEXT, true); got != want {
+		t.Fatalf("text output\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFormatConcurrentWrites(t *testing.T) {
+	var buf bytes.Buffer
+	w := newResultWriter(&buf, FORMAT_CSV, nil, true)
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				w.write(formatResults[1])
+			}
+		}()
+	}
+	wg.Wait()
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1+8*50 {
+		t.Fatalf("%d rows, want %d", len(rows), 1+8*50)
+	}
+}
+
+func TestCheckFormat(t *testing.T) {
+	for _, f := range []string{FORMAT_TEXT, FORMAT_TSV, FORMAT_CSV, FORMAT_JSONL, FORMAT_ID} {
+		if err := checkFormat(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := checkFormat("xml"); err == nil {
+		t.Fatal("an unknown format was accepted")
+	}
+}
+
+func TestFormatClusters(t *testing.T) {
+	var entries []hh.IndexEntry
+	for i, s := range []string{
+		"j362e4894.00000000000000000000000000000000",
+		"j362e4894.01000000000000000000000000000000",
+		"j362e4894.ffffffffffffffffffffffffffffffff",
+	} {
+		id, err := hh.ParseIdentifier(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, hh.IndexEntry{Id: id, Label: "l,abel", Sha1: strings.Repeat(string(rune('a'+i)), 40)})
+	}
+	clusters, err := hh.ClusterEntries(entries, hh.ClusterOptions{Method: hh.CLUSTER_DBSCAN, Threshold: 1, MinPoints: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{FORMAT_TEXT, FORMAT_TSV, FORMAT_CSV, FORMAT_JSONL, FORMAT_ID} {
+		var buf bytes.Buffer
+		writeClusters(&buf, clusters, format)
+		var rows [][]string
+		switch format {
+		case FORMAT_CSV:
+			if rows, err = csv.NewReader(&buf).ReadAll(); err != nil {
+				t.Fatal(err)
+			}
+		case FORMAT_JSONL:
+			dec := json.NewDecoder(&buf)
+			for dec.More() {
+				var r struct{ Cluster, Medoid, Label, Id, Sha1 string }
+				if err := dec.Decode(&r); err != nil {
+					t.Fatal(err)
+				}
+				rows = append(rows, []string{r.Cluster, r.Medoid, r.Label, r.Id})
+			}
+		default:
+			for _, l := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+				if format == FORMAT_ID {
+					rows = append(rows, strings.Split(l, " "))
+				} else {
+					rows = append(rows, strings.Split(l, "\t"))
+				}
+			}
+		}
+
+		members := rows
+		if format == FORMAT_TEXT || format == FORMAT_TSV || format == FORMAT_CSV {
+			if !reflect.DeepEqual(rows[0], clusterColumns) {
+				t.Fatalf("%s: header %q", format, rows[0])
+			}
+			members = rows[1:]
+		}
+		if len(members) != len(entries) {
+			t.Fatalf("%s: %d rows, want %d", format, len(members), len(entries))
+		}
+		// the cluster of two comes first, the outlier is noise
+		if members[0][0] != clusters[0].ID || members[1][0] != clusters[0].ID || members[2][0] != "noise" {
+			t.Fatalf("%s: clusters %q %q %q", format, members[0][0], members[1][0], members[2][0])
+		}
+	}
+}
@@ -14,35 +14,23 @@ import (
 	_ "embed"
 	"strings"
 	"bytes"
-	"sync"
 	"flag"
 	"fmt"
-	"net"
 	"os"
 	"io"
+	"runtime"
 	"syscall"
 	"time"
 	"net/http"
-    "crypto/sha1"
 	"encoding/json"
-	"path/filepath"
 
-	"github.com/OneOfOne/xxhash"
-	"github.com/hosom/gomagic"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	hh "github.com/wessorh/HuntingHash"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
-
-	"github.com/glaslos/ssdeep"
-	"github.com/glaslos/tlsh"
-	"github.com/eciavatta/sdhash"
-)
-
-const (
-	BUFFER_LEN_MIN = 64
 )
 
 var (
@@ -50,7 +38,7 @@ var (
 	damonize    *bool
 	dna         *bool
 	location    string
-	ep          string // execution pattern (client, server, stand_alone)
+	ep          string // execution pattern (client, server, stand_alone, cluster)
 	filename    string
 	verbose     *bool
 	ssdf        *bool
@@ -58,6 +46,25 @@ var (
 	do_sdhash   *bool
 	do_tlsh		*bool
 	dir			string
+	spoolDir	string
+	metric		string
+	storeDir	string
+	curveMode	string
+	curveAlg	string
+	curveOrder	*uint
+	curveCache	*uint
+	storeSync	*bool
+	pyramid		*bool
+	filterName	string
+	classifierName	string
+	magicRules	string
+	serverMode	*bool
+	clientMode	*bool
+	help		*bool
+	licence		*bool
+	debug		*bool
+	maxStream	string
+	batchMax	int
 
 	//go:embed LICENSE.md
 	LICENCE string
@@ -67,8 +74,11 @@ type HollomanServer struct {
 	hh.HollomanServer
 
 	curve 	*hh.HilbertCurve
-	m     	*magic.Magic
-	mu 		sync.Mutex // mutex prevents cgo memory access errors on calls to libmagic
+	hasher	*hh.Hasher
+	index	*hh.SimilarityIndex
+	store	*hh.Store
+	tokens	*tokenStore
+	metrics	*serverMetrics
 }
 
 
@@ -76,16 +86,80 @@ func NewServer(curve *hh.HilbertCurve, dna bool) (s *HollomanServer, err error)
 
 	s = new(HollomanServer)
 	s.curve = curve
+	s.hasher, err = newHasher(curve, dna)
+	if err != nil {
+		return nil, err
+	}
+	s.hasher.Ssdeep = *ssdf
+	s.hasher.Tlsh = *do_tlsh
+	s.hasher.Sdhash = *do_sdhash
+	s.hasher.Pyramid = *pyramid
+	s.hasher.Filter, err = hh.ParseResampleFilter(filterName)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := metricByName(metric)
+	if err != nil {
+		return nil, err
+	}
+	s.index = hh.NewSimilarityIndex(m)
+	s.metrics = newServerMetrics(s, int(curve.Order))
+	s.hasher.Timings = s.metrics.stage
+	if s.hasher.MaxStream, err = parseBytes(maxStream); err != nil {
+		return nil, fmt.Errorf("-max-stream: %w", err)
+	}
+	return s, nil
+}
+
+// newHasher opens the -classifier backend and loads the -magic-rules, DNA
+// hashers need neither
+func newHasher(curve *hh.HilbertCurve, dna bool) (*hh.Hasher, error) {
+	if dna {
+		return hh.NewClassifierHasher(curve, nil)
+	}
+	classifier, err := hh.OpenClassifier(classifierName, runtime.GOMAXPROCS(0))
 	if err != nil {
 		return nil, err
 	}
-	if !dna {
-		s.m, err = magic.Open(magic.MAGIC_NONE)
+	h, err := hh.NewClassifierHasher(curve, classifier)
+	if err != nil {
+		classifier.Close()
+		return nil, err
+	}
+
+	switch magicRules {
+	case "":
+	case "default":
+		h.Normalizer = hh.DefaultMagicNormalizer()
+	default:
+		h.Normalizer, err = hh.LoadMagicNormalizer(magicRules)
 		if err != nil {
-			log.Fatal().Msg(err.Error())
+			h.Close()
+			return nil, err
 		}
 	}
-	return s, nil
+	return h, nil
+}
+
+// toBufferResponse copies a library result into the protocol message
+func toBufferResponse(res *hh.Result) *hh.BufferResponse {
+	return &hh.BufferResponse{
+		HOrder: res.HOrder,
+		Len:    res.Len,
+		Id:     res.Id,
+		Magic:  res.Magic,
+		Ssdeep: res.Ssdeep,
+		Sha1:   res.Sha1,
+		Label:  res.Label,
+		Tlsh:   res.Tlsh,
+		Sdhash: res.Sdhash,
+		Id2:    res.Id2,
+		Id8:    res.Id8,
+		Id16:   res.Id16,
+
+		NormalizedMagic: res.NormalizedMagic,
+	}
 }
 func restCapabilities(hs *HollomanServer) http.Handler {
 
@@ -105,17 +179,52 @@ func restCapabilities(hs *HollomanServer) http.Handler {
 	return http.HandlerFunc(fn)
 }
 
+// serverStats is served by /holloman/v2/stats
+type serverStats struct {
+	Magic         hh.MagicStats
+	MagicWaitMean time.Duration // per lookup that waited
+	Indexed       int
+	Stored        int
+}
+
+func restStats(hs *HollomanServer) http.Handler {
+
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		st := serverStats{Magic: hs.hasher.MagicStats(), Indexed: hs.index.Len()}
+		if st.Magic.Waits > 0 {
+			st.MagicWaitMean = st.Magic.WaitTime / time.Duration(st.Magic.Waits)
+		}
+		if hs.store != nil {
+			st.Stored = hs.store.Len()
+		}
+		js, err := json.Marshal(st)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(js)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
 func restClusterBuffer(hs *HollomanServer) http.Handler {
 
 	fn := func(w http.ResponseWriter, r *http.Request) {
-        log.Info().Msgf("%v", r)
+		log.Debug().Msgf("%s %s", r.Method, r.URL.Path)
 		breq := new(hh.BufferRequest)
-		r.ParseMultipartForm(32 << 20) // limit your max input length!
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			restFormError(w, err)
+			return
+		}
 		var buf bytes.Buffer
 		// in your case file would be fileupload
 		file, header, err := r.FormFile("holloman-data")
 		if err != nil {
-			panic(err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 		defer file.Close()
 		name := strings.Split(header.Filename, ".")
@@ -125,7 +234,17 @@ func restClusterBuffer(hs *HollomanServer) http.Handler {
 		io.Copy(&buf, file)
 
 		breq.Buffer = buf.Bytes()
-		resp, err := hs.ClusterBuffer(context.Background(), breq)
+		breq.Pyramid = r.FormValue("pyramid") == "true"
+		breq.Filter = r.FormValue("filter")
+		if err := admitRequest(r.Context(), breq); err != nil {
+			restAuthError(w, err)
+			return
+		}
+		resp, err := hs.ClusterBuffer(r.Context(), breq)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		log.Debug().Msgf("/holloman/v2/hh128 %v", resp)
 		js, err := json.Marshal(resp)
 		if err != nil {
@@ -141,36 +260,73 @@ func restClusterBuffer(hs *HollomanServer) http.Handler {
 }
 
 
-func restServer(hs *HollomanServer) {
-
-	http.Handle("/holloman/v2/capabilities", restCapabilities(hs))
-	http.Handle("/holloman/v2/hh128", restClusterBuffer(hs))
-
-	log.Error().Msgf("server: %v", http.ListenAndServe(rest_port, nil))
-}
-
 func init() {
 
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stdout})
 
 	flag.StringVar(&curveFile, "curve", "hilbert_curve.dat.gz", "pre-generated hilbert curve (gzip compressed)")
-	flag.StringVar(&location, "grpc", ":50051", "location to listen :port or /path/to/unix.socket")
+	flag.StringVar(&curveMode, "curve-mode", "file", "file: load -curve, mmap: map a page aligned -curve, computed: compute points on the fly")
+	flag.StringVar(&curveAlg, "curve-algorithm", "gray", "computed curve mapping: gray (matches the curve files) or hilbert")
+	flag.StringVar(&location, "grpc", ":50051", "location to listen :port or /path/to/unix.socket, serve leaves gRPC out when empty")
 	flag.StringVar(&filename, "f", "", "file to generate an identifier for")
-	flag.StringVar(&rest_port, "rest-port", ":50005", "port to listen for REST transactions")
-	flag.StringVar(&dir, "d", "", "recursive process all fines in directory")
-
-	server := flag.Bool("S", false, "Server")
-	client := flag.Bool("C", false, "Client")
-	help := flag.Bool("h", false, "help")
+	flag.StringVar(&rest_port, "rest-port", ":50005", "port to listen for REST transactions, :port or /path/to/unix.socket, serve leaves REST out when empty")
+	flag.StringVar(&socketMode, "socket-mode", "0660", "permissions of the unix sockets hollomand listens on")
+	flag.StringVar(&socketOwner, "socket-owner", "", "user[:group] owning the unix sockets hollomand listens on")
+	flag.StringVar(&tlsOpts.cert, "tls-cert", "", "PEM certificate, the server's when serving, the client certificate in client mode; reloaded when the file changes")
+	flag.StringVar(&tlsOpts.key, "tls-key", "", "PEM private key of -tls-cert")
+	flag.StringVar(&tlsOpts.clientCA, "tls-client-ca", "", "serving: require client certificates issued by the CAs in this PEM file")
+	flag.Var(&tlsOpts.allowed, "tls-allowed-subjects", "serving: accept only client certificates whose common name, subject or DNS, email or URI name matches this glob, * does not match /, may be repeated")
+	flag.BoolVar(&tlsOpts.enable, "tls", false, "client: connect over TLS, verifying the server against the system roots")
+	flag.StringVar(&tlsOpts.ca, "tls-ca", "", "client: connect over TLS, verifying the server against the CAs in this PEM file")
+	flag.StringVar(&tlsOpts.serverName, "tls-server-name", "", "client: name expected in the server certificate, the host of -grpc when empty")
+	flag.StringVar(&tokenFile, "tokens", "", "serving: require a bearer token listed in this file, with its rate, buffer size and daily byte limits")
+	flag.StringVar(&clientToken, "token", os.Getenv("HOLLOMAN_TOKEN"), "client: bearer token sent to hollomand, $HOLLOMAN_TOKEN by default")
+	flag.BoolVar(&tokenInsecure, "token-insecure", false, "client: send -token over tcp without -tls")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", 10*time.Second, "time requests in progress are given to finish on SIGINT or SIGTERM")
+	flag.StringVar(&dir, "d", "", "recursively hash every file in directory, stand alone or client mode")
+	flag.IntVar(&dirOpts.workers, "workers", runtime.GOMAXPROCS(0), "-d: files hashed concurrently")
+	flag.Var(&dirOpts.include, "include", "-d: only hash files whose name or relative path matches one of these globs, comma separated or repeated")
+	flag.Var(&dirOpts.exclude, "exclude", "-d: leave out files and directories whose name or relative path matches one of these globs")
+	flag.Int64Var(&dirOpts.minSize, "min-size", hh.BUFFER_LEN_MIN, "-d: skip files smaller than this many bytes")
+	flag.Int64Var(&dirOpts.maxSize, "max-size", 0, "-d: skip files larger than this many bytes, no limit when 0")
+	flag.StringVar(&dirOpts.symlinks, "symlinks", SYMLINKS_SKIP, "-d: skip symbolic links, hash the files they point at, or follow them into directories too: skip, files or follow")
+	flag.StringVar(&outputFormat, "format", FORMAT_TEXT, "output of -f, -d, -spool and cluster: text, tsv or csv with a header, jsonl (every BufferResponse field) or id")
+	flag.StringVar(&spoolDir, "spool", "", "watch this inbox, hash every file dropped into it and move it to -spool-done or -spool-failed, stand alone or client mode")
+	flag.StringVar(&spoolOpts.done, "spool-done", "", "-spool: directory for hashed files, inbox/done when empty")
+	flag.StringVar(&spoolOpts.failed, "spool-failed", "", "-spool: directory for files that could not be hashed, inbox/failed when empty")
+	flag.StringVar(&spoolOpts.out, "spool-out", "-", "-spool: append results to this file, - for stdout")
+	flag.DurationVar(&spoolOpts.settle, "spool-settle", 2*time.Second, "-spool: a file the watcher missed is complete once unchanged this long")
+	flag.DurationVar(&spoolOpts.poll, "spool-poll", 5*time.Second, "-spool: interval between rescans of the inbox")
+	flag.StringVar(&storeDir, "store", "", "directory of the persistent identifier store, disabled when empty")
+	flag.StringVar(&metric, "metric", "hamming", "distance used by the search index: hamming or l1")
+	flag.StringVar(&classifierName, "classifier", "libmagic", "type classifier of the identifier prefix: libmagic or signature (pure Go, host independent)")
+	flag.StringVar(&magicRules, "magic-rules", "", "normalise magic before hashing it into the prefix: default for the built in rules or a rule file, off when empty")
+	flag.StringVar(&maxStream, "max-stream", "0", "longest buffer ClusterStream accepts, K, M or G, 0 for what the curve holds")
+	flag.IntVar(&batchMax, "batch-max", 1024, "most buffers ClusterBatch and /holloman/v2/batch take in one request")
+	flag.StringVar(&filterName, "filter", "", "resampling filter: box, bilinear, bicubic, lanczos2 or lanczos3, the default")
+
+	serverMode = flag.Bool("S", false, "gRPC server, \"hollomand [flags] serve\" serves gRPC and REST")
+	clientMode = flag.Bool("C", false, "Client")
+	help = flag.Bool("h", false, "help")
 	ssdf = flag.Bool("ssdeep", false, "enable ssdeep results")
 	dna = flag.Bool("dna", false, "the server should only be used for DNA clustering")
 	verbose = flag.Bool("v", false, "verbose")
-	licence := flag.Bool("license", false, "print licence")
+	licence = flag.Bool("license", false, "print licence")
     do_tlsh = flag.Bool("tlsh", false, "calculate TLSH")
     do_sdhash = flag.Bool("sdhash", false, "calculate TLSH")
 
-	debug := flag.Bool("debug", false, "sets log level to debug")
+	curveOrder = flag.Uint("curve-order", 15, "order of the computed curve")
+	curveCache = flag.Uint("curve-cache", 10, "orders tabulated by the computed curve")
+	storeSync = flag.Bool("store-sync", true, "fsync the store after every write")
+	pyramid = flag.Bool("pyramid", false, "also compute the 2x2, 8x8 and 16x16 identifiers")
+
+	debug = flag.Bool("debug", false, "sets log level to debug")
+}
+
+// parseFlags reads the command line registered in init and selects the
+// entry point, tests of the package keep the defaults
+func parseFlags() {
 	flag.Parse()
 
 	if *licence {
@@ -183,15 +339,24 @@ func init() {
 		os.Exit(0)
 	}
 
-	ep = "stand_alone"
-	if *server {
+	switch {
+	case flag.Arg(0) == "cluster":
+		ep = "cluster"
+	case flag.Arg(0) == "token":
+		ep = "token"
+	case flag.Arg(0) == "serve":
+		ep = "serve"
+	case *serverMode:
 		ep = "server"
-	} else if *client {
+	case *clientMode:
 		ep = "client"
-	} else if len(rest_port) > 0 {
+	case len(filename) > 0 || len(dir) > 0 || len(spoolDir) > 0:
+		ep = "stand_alone"
+	case len(rest_port) > 0:
 		ep = "rest_server"
-	} else {
+	default:
 		flag.Usage()
+		os.Exit(2)
 	}
 
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
@@ -204,47 +369,6 @@ func init() {
 }
 
 
-func dirIsEmpty(name string) (bool, error) {
-	f, err := os.Open(name)
-	if err != nil {
-		return false, err
-	}
-	defer f.Close()
-
-	_, err = f.Readdirnames(1) // Or f.Readdir(1)
-	if err == io.EOF {
-		return true, nil
-	}
-	return false, err // Either not empty or error, suits both cases
-}
-
-func producer(path string, info os.FileInfo, err error) error {
-	return nil
-}
-
-func processDirectory(dir string){
-			// walk the dir until it is empty
-			for {
-				err := filepath.Walk(dir, producer)
-
-				if err != nil {
-					log.Error().Msg(err.Error())
-					continue
-				}
-
-				is_empty, err := dirIsEmpty(dir)
-
-				if is_empty || err != nil {
-					log.Info().Msgf("%s is empty\n", dir)
-					break
-				}
-
-				// default exit loop until we write better dir empty code...
-				break
-			}
-}
-
-
 func readStdIn() []byte {
     var result []byte
     buffer := make([]byte, 1024)
@@ -282,40 +406,53 @@ func client() {
 	}
 	log.Info().Msgf("Capabilities received: %v", capabilities)
 **/
+	if len(dir) > 0 || len(spoolDir) > 0 {
+		hash := func(f dirFile) (*hh.BufferResponse, error) { return client.ClusterFile(f.path) }
+		if err := processFiles(hash, clientLine); err != nil {
+			log.Fatal().Msg(err.Error())
+		}
+		return
+	}
+
 	// Example: Cluster buffer
+	var rsp *hh.BufferResponse
 	if filename == "-" {
 		buffer = readStdIn()
-	}else{
-		buffer, err = getMmappedBuffer(filename)
-		if err != nil {
-			log.Fatal().Msgf(err.Error())
-		}
-		defer syscall.Munmap(buffer)
+		rsp, err = client.ClusterBuffer(buffer, filename)
+	} else {
+		rsp, err = client.ClusterFile(filename)
 	}
-	//sampleBuffer := []byte("sample data")
-	rsp, err := client.ClusterBuffer(buffer, filename)
 	if err != nil {
 		log.Fatal().Msgf("Failed to cluster buffer: %v", err)
 	}
 	log.Debug().Msgf("Cluster response received: HOrder=%d, Id=%s, Magic=%s",
 		rsp.HOrder, rsp.Id, rsp.Magic)
-	fmt.Printf("%s\t%s\t%s\t%s\t%s\n", filename, rsp.Id, rsp.Ssdeep, rsp.Tlsh, rsp.Sdhash)
+	newResultWriter(os.Stdout, outputFormat, clientLine, true).write(dirResult{BufferResponse: rsp, Path: filename})
 
 }
 
-func server(srvr *HollomanServer) {
-	lis, err := net.Listen("tcp", location)
-	if err != nil {
-		log.Fatal().Msgf("failed to listen: %v", err)
+// clientLine formats a client mode result
+func clientLine(filename string, rsp *hh.BufferResponse) string {
+	if *pyramid {
+		return fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s", filename, rsp.Id, rsp.Ssdeep, rsp.Tlsh, rsp.Sdhash, rsp.Id2, rsp.Id8, rsp.Id16)
 	}
+	return fmt.Sprintf("%s\t%s\t%s\t%s\t%s", filename, rsp.Id, rsp.Ssdeep, rsp.Tlsh, rsp.Sdhash)
+}
 
-	s := grpc.NewServer(grpc.MaxRecvMsgSize(1024*10e7), grpc.MaxSendMsgSize(1024*10e7), withServerUnaryInterceptor())
-	hh.RegisterHollomanServer(s, srvr)
+// processFiles hashes the -spool inbox or the -d directory
+func processFiles(hash hashFunc, line lineFunc) error {
+	if len(spoolDir) > 0 {
+		return spoolDirectory(spoolDir, spoolOpts, dirOpts.workers, hash, line)
+	}
+	return processDirectory(dir, dirOpts, hash, line)
+}
 
-	log.Debug().Msgf("server listening at %v", lis.Addr())
-	if err := s.Serve(lis); err != nil {
-		log.Fatal().Msgf("failed to serve: %v", err)
+// standAloneLine formats a stand alone result
+func standAloneLine(filename string, rsp *hh.BufferResponse) string {
+	if *pyramid {
+		return fmt.Sprintf("%s %s %s %s %s", filename, rsp.Id, rsp.Id2, rsp.Id8, rsp.Id16)
 	}
+	return fmt.Sprintf("%s %s", filename, rsp.Id)
 }
 
 func serverInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
@@ -338,6 +475,9 @@ func (server *HollomanServer) Capabilities(context.Context, *hh.ServiceCapabilit
 	cah.MaxOrder = int32(server.curve.Order)
 
 	cah.Magic = "filemagic"
+	if server.hasher.Classifier != nil && server.hasher.Classifier.Name() == hh.CLASSIFIER_SIGNATURE {
+		cah.Magic = hh.CLASSIFIER_SIGNATURE
+	}
 	if *dna {
 		cah.Magic = "dna/iching"
 	}
@@ -346,84 +486,98 @@ func (server *HollomanServer) Capabilities(context.Context, *hh.ServiceCapabilit
 		cah.Ssdeep = true
 	}
 
+	// the default filter leads the list
+	cah.Filters = []string{server.hasher.Filter.String()}
+	for _, name := range hh.FilterNames() {
+		if name != cah.Filters[0] {
+			cah.Filters = append(cah.Filters, name)
+		}
+	}
+
 	return cah, nil
 }
 
 func (server *HollomanServer) ClusterBuffer(ctx context.Context, req *hh.BufferRequest) (br *hh.BufferResponse, err error) {
 
-	var voxel []byte
-	br = new(hh.BufferResponse)
-	if len(req.Label) > 0 {
-		br.Label=req.Label
-	}
-	if len(req.Buffer) < 64 {
-		return nil, fmt.Errorf("buffer length of %d is too small. minum length is %d", len(req.Buffer), BUFFER_LEN_MIN)
+	res, err := server.hash(req, false)
+	if err != nil {
+		return nil, err
 	}
-	voxel, br.HOrder, err = server.curve.MapBuffer(req.Buffer)
-	if *dna {
-		br.Magic = "dna/iching"
-		br.Id = fmt.Sprintf("%c.%032x", hh.ORDER_ALPHABET[br.HOrder], voxel)
-	} else {
-		server.mu.Lock()
-		br.Magic, err = server.m.Buffer(req.Buffer)
-		// br.Magic = magic.Buffer( server.m, req.Buffer)
-		defer server.mu.Unlock()
-		_ = err
-		ch32 := xxhash.ChecksumString32(fmt.Sprintf("%-60.60s", br.Magic))
-		br.Id = fmt.Sprintf("%c%08x.%32.32x", hh.ORDER_ALPHABET[br.HOrder], ch32, voxel)
-		// preform sha1 on buffer
- 		var sha = sha1.New()
- 		sha.Write(req.Buffer)
- 		br.Sha1 = fmt.Sprintf("%40x", sha.Sum(nil))
- 		br.Label = req.Label
-	}
-
-	if *ssdf && len(req.Buffer) > 4096 {
-		//preform ssdeep hash on buffer
-		s, err := ssdeep.FuzzyBytes(req.Buffer)
+
+	return toBufferResponse(res), nil
+}
+
+func withServerUnaryInterceptor() grpc.ServerOption {
+	return grpc.UnaryInterceptor(serverInterceptor)
+}
+// loadCurve reads the compressed curve, or builds a computed one, as
+// selected by -curve-mode
+func loadCurve() (curve *hh.HilbertCurve, err error) {
+	switch curveMode {
+	case "file":
+		curve, err = hh.LoadHilbertCurve(curveFile)
 		if err != nil {
-			br.Ssdeep = err.Error()
+			return nil, fmt.Errorf("curve file %s is invalid: %w", curveFile, err)
 		}
-		br.Ssdeep = s
-	}
+		log.Debug().Msgf("loaded order %d hilbert curve from %s", curve.Order, curveFile)
 
-	if *do_sdhash {
-		f, err:= sdhash.CreateSdbfFromBytes(req.Buffer)
-		if err == nil {
-			sdbf := f.Compute()
-			br.Sdhash = sdbf.String()
+	case "mmap":
+		curve, err = hh.MmapHilbertCurve(curveFile)
+		if err != nil {
+			return nil, fmt.Errorf("curve file %s is invalid: %w", curveFile, err)
 		}
-	}
+		log.Debug().Msgf("mapped order %d %s curve from %s", curve.Order, curve.Algorithm, curveFile)
 
-	if *do_tlsh && len(req.Buffer) > 256 {
-		f, err := tlsh.HashBytes(req.Buffer)
-		if err == nil {
-			br.Tlsh = f.String()
+	case "computed":
+		alg, err := hh.ParseCurveAlgorithm(curveAlg)
+		if err != nil {
+			return nil, err
 		}
-	}
-
+		curve, err = hh.NewComputedHilbertCurve(uint32(*curveOrder), alg, uint32(*curveCache))
+		if err != nil {
+			return nil, err
+		}
+		log.Debug().Msgf("computed order %d %s curve, orders up to %d cached", curve.Order, alg, *curveCache)
 
-	return br, nil
+	default:
+		return nil, fmt.Errorf("unknown curve mode %q, use file, mmap or computed", curveMode)
+	}
+	return curve, nil
 }
 
-func withServerUnaryInterceptor() grpc.ServerOption {
-	return grpc.UnaryInterceptor(serverInterceptor)
+// serving reports whether the execution pattern runs listeners
+func serving(ep string) bool {
+	return ep == "server" || ep == "rest_server" || ep == "serve"
 }
+
 func main() {
+	parseFlags()
+
 	var srvr *HollomanServer
 
-	if curveFile == "" {
+	if ep == "token" {
+		if flag.NArg() != 2 {
+			log.Fatal().Msg("usage: hollomand token name")
+		}
+		if err := newToken(flag.Arg(1)); err != nil {
+			log.Fatal().Msg(err.Error())
+		}
+		return
+	}
+
+	if curveFile == "" && curveMode != "computed" {
 		flag.Usage()
 		return
 	}
+	if err := checkFormat(outputFormat); err != nil {
+		log.Fatal().Msg(err.Error())
+	}
 
-	if ep != "client" {
-		//read the compressed curve
-		curve, err := hh.LoadHilbertCurve(curveFile)
+	if ep != "client" && ep != "cluster" {
+		curve, err := loadCurve()
 		if err != nil {
-			log.Fatal().Msgf("curve file %s is invalid", curveFile)
+			log.Fatal().Msg(err.Error())
 		}
-		log.Debug().Msgf("loaded order %d hilbert curve from %s", curve.Order, curveFile)
 
 		// start server, damonize?
 		srvr, err = NewServer(curve, *dna)
@@ -431,77 +585,81 @@ func main() {
 			log.Error().Msg(err.Error())
 			return
 		}
+
+		if serving(ep) && len(storeDir) > 0 {
+			if err := srvr.openStore(storeDir, *storeSync); err != nil {
+				log.Fatal().Msgf("store %s: %v", storeDir, err)
+			}
+		}
+		if serving(ep) && len(tokenFile) > 0 {
+			if srvr.tokens, err = loadTokens(tokenFile); err != nil {
+				log.Fatal().Msgf("tokens: %v", err)
+			}
+			log.Info().Msgf("%d api tokens from %s", len(srvr.tokens.tokens), tokenFile)
+		}
 	}
 
 	switch ep {
-	case "server":
-		server(srvr)
-
-	case "rest_server":
-		restServer(srvr)
+	case "server", "rest_server", "serve":
+		grpcAddress, restAddress := location, rest_port
+		switch ep {
+		case "server":
+			restAddress = ""
+		case "rest_server":
+			grpcAddress = ""
+		}
+		listeners, err := listen(srvr, grpcAddress, restAddress)
+		if err != nil {
+			log.Fatal().Msg(err.Error())
+		}
+		if err := serve(srvr, listeners); err != nil {
+			log.Fatal().Msg(err.Error())
+		}
 
 	case "client":
 		client()
 
+	case "cluster":
+		clusterCommand(flag.Args()[1:])
+
 	case "stand_alone":
-		//read the compressed curve
-		curve, err := hh.LoadHilbertCurve(curveFile)
-		if filename == "" {
+		if filename == "" && dir == "" && spoolDir == "" {
+			return
+		}
+		if *dna {
+			fmt.Printf("This program is uable to cluster DNA in standalone mode\n")
+			return
+		}
+		if len(dir) > 0 || len(spoolDir) > 0 {
+			hash := func(f dirFile) (*hh.BufferResponse, error) {
+				res, err := srvr.hasher.HashFile(f.path)
+				if err != nil {
+					return nil, err
+				}
+				return toBufferResponse(res), nil
+			}
+			if err := processFiles(hash, standAloneLine); err != nil {
+				log.Fatal().Msg(err.Error())
+			}
 			return
 		}
-		buffer, err := getMmappedBuffer(filename)
+		res, err := srvr.hasher.HashFile(filename)
 		if err != nil {
 			log.Fatal().Msgf(err.Error())
 		}
-		defer syscall.Munmap(buffer)
-		voxel, order, err := curve.MapBuffer(buffer)
-		mbuff, err := srvr.m.Buffer(buffer)
-		// mbuff := magic.Buffer(srvr.m, buffer)
-		ch32 := xxhash.ChecksumString32(fmt.Sprintf("%-60.60s", mbuff))
-
-		if *dna {
-			fmt.Printf("This program is uable to cluster DNA in standalone mode\n")
-		} else {
-			if *verbose {
-				fmt.Printf("magic: %s\n", mbuff)
+		if *verbose {
+			fmt.Printf("magic: %s\n", res.Magic)
+			if res.NormalizedMagic != res.Magic {
+				fmt.Printf("normalized magic: %s\n", res.NormalizedMagic)
 			}
-			fmt.Printf("%s %c%08x.%32.32x\n", filename, hh.ORDER_ALPHABET[order], ch32, voxel)
 		}
+		newResultWriter(os.Stdout, outputFormat, standAloneLine, true).write(dirResult{BufferResponse: toBufferResponse(res), Path: filename})
 
 	default:
 		flag.Usage()
 	}
 }
 
-func getMmappedBuffer(filename string) ([]byte, error) {
-	// Open the file
-	file, err := os.OpenFile(filename, os.O_RDONLY, 0)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open file: %w", err)
-	}
-	defer file.Close()
-
-	// Get the file size
-	stat, err := file.Stat()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get file stats: %w", err)
-	}
-
-	// Memory map the file
-	buffer, err := syscall.Mmap(
-		int(file.Fd()),
-		0,
-		int(stat.Size()),
-		syscall.PROT_READ,
-		syscall.MAP_SHARED,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to mmap file: %w", err)
-	}
-
-	return buffer, nil
-}
-
 type HollomanClient struct {
 	client hh.HollomanClient
 	conn   *grpc.ClientConn
@@ -510,9 +668,23 @@ type HollomanClient struct {
 // NewHollomanClient creates a new client instance
 func NewHollomanClient(serverAddr string) (*HollomanClient, error) {
 	// Set up connection with the server
-	conn, err := grpc.Dial(serverAddr,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithBlock())
+	creds := insecure.NewCredentials()
+	config, err := clientTLSConfig(tlsOpts)
+	if err != nil {
+		return nil, err
+	}
+	if config != nil {
+		creds = credentials.NewTLS(config)
+	}
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(creds), grpc.WithBlock()}
+	if len(clientToken) > 0 {
+		token := newBearerToken(clientToken, serverAddr)
+		if config == nil && token.RequireTransportSecurity() {
+			return nil, fmt.Errorf("-token is sent in the clear to %s, use -tls or -token-insecure", serverAddr)
+		}
+		opts = append(opts, grpc.WithPerRPCCredentials(token))
+	}
+	conn, err := grpc.Dial(grpcTarget(serverAddr), opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -542,6 +714,30 @@ func (c *HollomanClient) GetCapabilities(acceleration string, maxOrder int32) (*
 	return c.client.Capabilities(ctx, capabilities)
 }
 
+// ClusterFile sends filename to the server, files larger than STREAM_ABOVE
+// are streamed rather than sent in a single message
+func (c *HollomanClient) ClusterFile(filename string) (*hh.BufferResponse, error) {
+	st, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	if st.Mode().IsRegular() && st.Size() > STREAM_ABOVE {
+		file, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return c.ClusterStream(file, st.Size(), filename)
+	}
+
+	buffer, err := hh.MmapFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Munmap(buffer)
+	return c.ClusterBuffer(buffer, filename)
+}
+
 // ClusterBuffer calls the ClusterBuffer RPC
 func (c *HollomanClient) ClusterBuffer(buffer []byte, filename string) (*hh.BufferResponse, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
@@ -550,6 +746,8 @@ func (c *HollomanClient) ClusterBuffer(buffer []byte, filename string) (*hh.Buff
 	request := &hh.BufferRequest{
 		Buffer: buffer,
 		Label: filename,
+		Pyramid: *pyramid,
+		Filter: filterName,
 	}
 
 	return c.client.ClusterBuffer(ctx, request)
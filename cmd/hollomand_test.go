@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	hh "github.com/wessorh/HuntingHash"
+)
+
+func TestMagicRulesFlag(t *testing.T) {
+	curve, err := hh.NewComputedHilbertCurve(8, hh.CURVE_GRAY, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := filepath.Join(t.TempDir(), "rules")
+	if err := os.WriteFile(rules, []byte("family script\n, ASCII text executable$ =>\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(c, r string) { classifierName, magicRules = c, r }(classifierName, magicRules)
+	classifierName = "signature"
+
+	script := []byte("#!/bin/sh\necho normalised magic\nexit 0\n")
+	for len(script) < hh.BUFFER_LEN_MIN {
+		script = append(script, "# padding\n"...)
+	}
+	for _, tc := range []struct{ rules, want string }{
+		{"", "POSIX shell script, ASCII text executable"},
+		{"default", "POSIX shell script, ASCII text executable"},
+		{rules, "POSIX shell script"},
+	} {
+		magicRules = tc.rules
+		h, err := newHasher(curve, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := h.HashBytes(script, "")
+		h.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Magic != "POSIX shell script, ASCII text executable" || res.NormalizedMagic != tc.want {
+			t.Fatalf("-magic-rules %q: magic %q normalised to %q, want %q", tc.rules, res.Magic, res.NormalizedMagic, tc.want)
+		}
+		id, err := res.Identifier()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id.MagicHash() != hh.MagicHash(tc.want) {
+			t.Fatalf("-magic-rules %q: the prefix hashes %q", tc.rules, res.Magic)
+		}
+	}
+
+	magicRules = filepath.Join(t.TempDir(), "missing")
+	if _, err := newHasher(curve, false); err == nil {
+		t.Fatal("a missing rule file was accepted")
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+//
+// Copyright 2025 (c) By Rick Wesson & Support Intelligence, Inc.
+// Licenced under the RLL 1.0
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	hh "github.com/wessorh/HuntingHash"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	SEARCH_K_DEFAULT = 10
+)
+
+// metricByName maps the -metric flag onto a distance function
+func metricByName(name string) (hh.Metric, error) {
+	switch name {
+	case "hamming", "":
+		return hh.HammingDistance, nil
+	case "l1":
+		return hh.L1Distance, nil
+	}
+	return nil, fmt.Errorf("unknown metric %q, use hamming or l1", name)
+}
+
+// Index clusters the buffer and adds the result to the server side index
+func (server *HollomanServer) Index(ctx context.Context, req *hh.BufferRequest) (*hh.BufferResponse, error) {
+
+	res, err := server.hash(req, true)
+	if err != nil {
+		return nil, err
+	}
+	// every level of a pyramid is indexed, each is searchable by its own id
+	ids, err := res.Identifiers()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	for _, id := range ids {
+		server.index.Insert(hh.IndexEntry{Id: id, Label: res.Label, Sha1: res.Sha1})
+	}
+	log.Debug().Msgf("indexed %s %s, %d entries", res.Id, res.Label, server.index.Len())
+
+	return toBufferResponse(res), nil
+}
+
+// Search returns the indexed identifiers closest to a buffer or an identifier
+func (server *HollomanServer) Search(ctx context.Context, req *hh.SearchRequest) (*hh.SearchResponse, error) {
+	var (
+		id  hh.Identifier
+		err error
+	)
+
+	switch {
+	case len(req.Id) > 0:
+		id, err = hh.ParseIdentifier(req.Id)
+	case len(req.Buffer) > 0:
+		var res *hh.Result
+		res, err = server.hasher.HashBytes(req.Buffer, "")
+		if err == nil {
+			server.metrics.result(res)
+			id, err = res.Identifier()
+		}
+	default:
+		err = fmt.Errorf("search requires a buffer or an identifier")
+	}
+	if err != nil {
+		return nil, invalidArgument(err)
+	}
+
+	// an unset MaxDistance is no limit, 0 is the identifier itself
+	max := -1
+	if req.MaxDistance != nil {
+		max = int(req.GetMaxDistance())
+	}
+	if req.K < 0 || (req.MaxDistance != nil && max < 0) {
+		return nil, status.Errorf(codes.InvalidArgument, "K %d and MaxDistance %d can not be negative", req.K, req.GetMaxDistance())
+	}
+
+	var neighbors []hh.Neighbor
+	switch {
+	case req.K > 0:
+		neighbors = server.index.Nearest(id, int(req.K), max)
+	case req.MaxDistance != nil:
+		neighbors = server.index.Radius(id, max)
+	default:
+		neighbors = server.index.Nearest(id, SEARCH_K_DEFAULT, -1)
+	}
+
+	rsp := &hh.SearchResponse{Id: id.String()}
+	for _, n := range neighbors {
+		rsp.Matches = append(rsp.Matches, &hh.Match{
+			Id:       n.Id.String(),
+			Label:    n.Label,
+			Sha1:     n.Sha1,
+			Distance: int32(n.Distance),
+		})
+	}
+	return rsp, nil
+}
+
+// Delete removes an identifier from the server side index
+func (server *HollomanServer) Delete(ctx context.Context, req *hh.DeleteRequest) (*hh.DeleteResponse, error) {
+
+	id, err := hh.ParseIdentifier(req.Id)
+	if err != nil {
+		return nil, invalidArgument(err)
+	}
+	removed := server.index.Delete(id, req.Sha1)
+	for _, e := range removed {
+		// the other levels of the buffer's pyramid leave the index too, the
+		// store knows their identifiers, without it they are looked for
+		if server.store == nil {
+			server.index.DeleteLevels(id, e.Sha1)
+			continue
+		}
+		if rec, ok := server.store.Get(e.Sha1); ok {
+			ids, _ := rec.Identifiers()
+			for _, other := range ids {
+				if other != id {
+					server.index.Delete(other, e.Sha1)
+				}
+			}
+		}
+		if err := server.store.SetIndexed(e.Sha1, false); err != nil {
+			log.Error().Msgf("store: %v", err)
+		}
+	}
+
+	return &hh.DeleteResponse{Deleted: int32(len(removed))}, nil
+}
+
+// Index calls the Index RPC
+func (c *HollomanClient) Index(buffer []byte, filename string) (*hh.BufferResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	request := &hh.BufferRequest{
+		Buffer: buffer,
+		Label:  filename,
+	}
+
+	return c.client.Index(ctx, request)
+}
+
+// Search calls the Search RPC
+func (c *HollomanClient) Search(request *hh.SearchRequest) (*hh.SearchResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	return c.client.Search(ctx, request)
+}
+
+// Delete calls the Delete RPC
+func (c *HollomanClient) Delete(id string, sha1 string) (*hh.DeleteResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	return c.client.Delete(ctx, &hh.DeleteRequest{Id: id, Sha1: sha1})
+}
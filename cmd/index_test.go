@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+
+	hh "github.com/wessorh/HuntingHash"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSearchMaxDistance(t *testing.T) {
+	hs := newTestServer(t)
+	client := startGRPC(t, hs)
+
+	// a buffer, a copy with one byte changed and an unrelated one
+	a := randomBuffer(1, 4000)
+	b := append([]byte(nil), a...)
+	b[100] ^= 0xff
+	var ids []string
+	for i, buffer := range [][]byte{a, b, randomBuffer(2, 4000)} {
+		rsp, err := client.Index(buffer, string(rune('a'+i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, rsp.Id)
+	}
+
+	distance := func(d int32) *int32 { return &d }
+	for _, tc := range []struct {
+		req  *hh.SearchRequest
+		want int
+	}{
+		{&hh.SearchRequest{Id: ids[0]}, 3},
+		{&hh.SearchRequest{Id: ids[0], K: 2}, 2},
+		{&hh.SearchRequest{Id: ids[0], MaxDistance: distance(0)}, 1},
+		{&hh.SearchRequest{Id: ids[0], K: 3, MaxDistance: distance(0)}, 1},
+		{&hh.SearchRequest{Buffer: a, MaxDistance: distance(0)}, 1},
+	} {
+		rsp, err := client.Search(tc.req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rsp.Matches) != tc.want {
+			t.Errorf("K %d MaxDistance %v: %d matches, want %d", tc.req.K, tc.req.MaxDistance, len(rsp.Matches), tc.want)
+		}
+		if len(rsp.Matches) > 0 && (rsp.Matches[0].Id != ids[0] || rsp.Matches[0].Distance != 0) {
+			t.Errorf("nearest match %v", rsp.Matches[0])
+		}
+	}
+
+	for _, req := range []*hh.SearchRequest{
+		{Id: ids[0], K: -1},
+		{Id: ids[0], MaxDistance: distance(-1)},
+		{Id: "j362e4894.zz"},
+		{},
+	} {
+		if _, err := client.Search(req); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("search %v: %v, want InvalidArgument", req, err)
+		}
+	}
+}
+
+func TestDeleteRemovesThePyramid(t *testing.T) {
+	hs := newTestServer(t)
+	hs.hasher.Pyramid = true
+	client := startGRPC(t, hs)
+
+	var rsps []*hh.BufferResponse
+	for i := int64(0); i < 3; i++ {
+		rsp, err := client.Index(randomBuffer(i, 3000), "buffer")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rsps = append(rsps, rsp)
+	}
+	if n := hs.index.Len(); n != 3*4 {
+		t.Fatalf("index holds %d entries, want the 4 levels of 3 buffers", n)
+	}
+
+	// deleting by any level takes the whole pyramid
+	for i, id := range []string{rsps[0].Id, rsps[1].Id8} {
+		if _, err := client.Delete(id, ""); err != nil {
+			t.Fatal(err)
+		}
+		if n := hs.index.Len(); n != (2-i)*4 {
+			t.Fatalf("index holds %d entries after deleting %s, want %d", n, id, (2-i)*4)
+		}
+	}
+	rsp, err := client.Search(&hh.SearchRequest{Id: rsps[2].Id2, K: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rsp.Matches) != 1 || rsp.Matches[0].Sha1 != rsps[2].Sha1 {
+		t.Errorf("level 2 matches %v, want only %s", rsp.Matches, rsps[2].Sha1)
+	}
+
+	if _, err := client.Delete("not an identifier", ""); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("delete of a bad identifier: %v", err)
+	}
+}
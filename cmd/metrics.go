@@ -0,0 +1,371 @@
+package main
+
+//
+// Copyright 2025 (c) By Rick Wesson & Support Intelligence, Inc.
+// Licenced under the RLL 1.0
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	hh "github.com/wessorh/HuntingHash"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const METRICS_PATH = "/metrics"
+
+// bucket bounds in seconds, of requests and of the stages of hashing a buffer
+var (
+	latencyBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+	stageBuckets   = []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+)
+
+// histogram counts observations into cumulative buckets, the caller locks
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, le := range h.bounds {
+		if v <= le {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// route is a protocol and the RPC or REST path a request went to
+type route struct {
+	protocol, method string
+}
+
+type requestSeries struct {
+	route
+	code string
+}
+
+type errorSeries struct {
+	protocol, kind string
+}
+
+// serverMetrics are served by /metrics in the Prometheus text format
+type serverMetrics struct {
+	hs *HollomanServer
+
+	mu       sync.Mutex
+	requests map[requestSeries]uint64
+	latency  map[route]*histogram
+	errors   map[errorSeries]uint64
+	inflight map[string]int64
+	stages   map[string]*histogram
+	orders   *histogram
+	hashed   uint64 // bytes
+	buffers  uint64
+}
+
+func newServerMetrics(hs *HollomanServer, maxOrder int) *serverMetrics {
+	orders := make([]float64, maxOrder)
+	for i := range orders {
+		orders[i] = float64(i + 1)
+	}
+	return &serverMetrics{
+		hs:       hs,
+		requests: make(map[requestSeries]uint64),
+		latency:  make(map[route]*histogram),
+		errors:   make(map[errorSeries]uint64),
+		inflight: make(map[string]int64),
+		stages:   make(map[string]*histogram),
+		orders:   newHistogram(orders),
+	}
+}
+
+// stage is the hasher's StageTimer
+func (m *serverMetrics) stage(stage string, elapsed time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.stages[stage]
+	if !ok {
+		h = newHistogram(stageBuckets)
+		m.stages[stage] = h
+	}
+	h.observe(elapsed.Seconds())
+}
+
+// result counts a buffer hashed and the order of the curve it took
+func (m *serverMetrics) result(res *hh.Result) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// no curve holds a buffer past math.MaxInt32, Len does not wrap
+	m.hashed += uint64(max(res.Len, 0))
+	m.buffers++
+	m.orders.observe(float64(res.HOrder))
+}
+
+// begin counts a request in flight until done is called with its outcome,
+// kind names the error when there was one
+func (m *serverMetrics) begin(protocol string) (done func(method, code, kind string)) {
+	start := time.Now()
+	m.mu.Lock()
+	m.inflight[protocol]++
+	m.mu.Unlock()
+
+	return func(method, code, kind string) {
+		elapsed := time.Since(start)
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.inflight[protocol]--
+		r := route{protocol, method}
+		m.requests[requestSeries{r, code}]++
+		h, ok := m.latency[r]
+		if !ok {
+			h = newHistogram(latencyBuckets)
+			m.latency[r] = h
+		}
+		h.observe(elapsed.Seconds())
+		if len(kind) > 0 {
+			m.errors[errorSeries{protocol, kind}]++
+		}
+	}
+}
+
+// errorKind names a gRPC code in snake case, ResourceExhausted is
+// resource_exhausted, OK is no error
+func errorKind(code codes.Code) string {
+	if code == codes.OK {
+		return ""
+	}
+	var b strings.Builder
+	for i, r := range code.String() {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// httpCode is the gRPC code of an HTTP status, so errors of both protocols
+// are counted by the same kinds
+func httpCode(statusCode int) codes.Code {
+	switch {
+	case statusCode < 400:
+		return codes.OK
+	case statusCode == http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case statusCode == http.StatusForbidden:
+		return codes.PermissionDenied
+	case statusCode == http.StatusNotFound:
+		return codes.NotFound
+	case statusCode == http.StatusRequestEntityTooLarge, statusCode == http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case statusCode == http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case statusCode < 500:
+		return codes.InvalidArgument
+	}
+	return codes.Internal
+}
+
+func (m *serverMetrics) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	done := m.begin("grpc")
+	rsp, err := handler(ctx, req)
+	code := status.Code(err)
+	done(info.FullMethod, code.String(), errorKind(code))
+	return rsp, err
+}
+
+func (m *serverMetrics) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) error {
+	done := m.begin("grpc")
+	err := handler(srv, ss)
+	code := status.Code(err)
+	done(info.FullMethod, code.String(), errorKind(code))
+	return err
+}
+
+// statusRecorder keeps the status code a handler wrote
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// instrument counts the REST requests next serves by the mux pattern they
+// match, other paths are counted together
+func (m *serverMetrics) instrument(mux *http.ServeMux, next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		done := m.begin("rest")
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			if rec.code == 0 {
+				rec.code = http.StatusOK
+			}
+			method := "other"
+			if _, pattern := mux.Handler(r); len(pattern) > 0 {
+				method = pattern
+			}
+			done(method, strconv.Itoa(rec.code), errorKind(httpCode(rec.code)))
+		}()
+		next.ServeHTTP(rec, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+var labelValue = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels renders name="value" pairs, they alternate in kv
+func labels(kv ...string) string {
+	if len(kv) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, kv[i], labelValue.Replace(kv[i+1])))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// metricWriter writes the text exposition format
+type metricWriter struct {
+	w io.Writer
+}
+
+func (mw metricWriter) header(name, kind, help string) {
+	fmt.Fprintf(mw.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func (mw metricWriter) sample(name, labels string, v float64) {
+	fmt.Fprintf(mw.w, "%s%s %s\n", name, labels, formatFloat(v))
+}
+
+// histogram writes the buckets, sum and count of h, kv are its labels
+func (mw metricWriter) histogram(name string, h *histogram, kv ...string) {
+	for i, le := range h.bounds {
+		mw.sample(name+"_bucket", labels(append(kv, "le", formatFloat(le))...), float64(h.counts[i]))
+	}
+	mw.sample(name+"_bucket", labels(append(kv, "le", "+Inf")...), float64(h.count))
+	mw.sample(name+"_sum", labels(kv...), h.sum)
+	mw.sample(name+"_count", labels(kv...), float64(h.count))
+}
+
+// sorted returns the keys of m in order of their rendering by key
+func sorted[K comparable, V any](m map[K]V, key func(K) string) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return key(keys[i]) < key(keys[j]) })
+	return keys
+}
+
+func (m *serverMetrics) write(w io.Writer) {
+	mw := metricWriter{w}
+	ms := m.hs.hasher.MagicStats()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mw.header("hollomand_requests_total", "counter", "Requests by protocol, RPC or REST route and status code.")
+	for _, s := range sorted(m.requests, func(s requestSeries) string { return s.protocol + s.method + s.code }) {
+		mw.sample("hollomand_requests_total", labels("protocol", s.protocol, "method", s.method, "code", s.code), float64(m.requests[s]))
+	}
+
+	mw.header("hollomand_request_duration_seconds", "histogram", "Time to answer a request.")
+	for _, r := range sorted(m.latency, func(r route) string { return r.protocol + r.method }) {
+		mw.histogram("hollomand_request_duration_seconds", m.latency[r], "protocol", r.protocol, "method", r.method)
+	}
+
+	mw.header("hollomand_requests_in_flight", "gauge", "Requests being answered.")
+	for _, p := range []string{"grpc", "rest"} {
+		mw.sample("hollomand_requests_in_flight", labels("protocol", p), float64(m.inflight[p]))
+	}
+
+	mw.header("hollomand_errors_total", "counter", "Failed requests by protocol and kind of error, the gRPC code in snake case.")
+	for _, s := range sorted(m.errors, func(s errorSeries) string { return s.protocol + s.kind }) {
+		mw.sample("hollomand_errors_total", labels("protocol", s.protocol, "kind", s.kind), float64(m.errors[s]))
+	}
+
+	mw.header("hollomand_hashed_bytes_total", "counter", "Bytes of the buffers hashed.")
+	mw.sample("hollomand_hashed_bytes_total", "", float64(m.hashed))
+	mw.header("hollomand_hashed_buffers_total", "counter", "Buffers hashed.")
+	mw.sample("hollomand_hashed_buffers_total", "", float64(m.buffers))
+
+	mw.header("hollomand_curve_order", "histogram", "Order of the curve buffers were mapped onto.")
+	mw.histogram("hollomand_curve_order", m.orders)
+
+	mw.header("hollomand_hash_stage_seconds", "histogram", "Time spent in each stage of hashing a buffer.")
+	for _, stage := range sorted(m.stages, func(s string) string { return s }) {
+		mw.histogram("hollomand_hash_stage_seconds", m.stages[stage], "stage", stage)
+	}
+
+	mw.header("hollomand_magic_handles", "gauge", "libmagic handles in the pool.")
+	mw.sample("hollomand_magic_handles", "", float64(ms.Handles))
+	mw.header("hollomand_magic_lookups_total", "counter", "libmagic lookups made.")
+	mw.sample("hollomand_magic_lookups_total", "", float64(ms.Lookups))
+	mw.header("hollomand_magic_waits_total", "counter", "libmagic lookups that waited for a handle.")
+	mw.sample("hollomand_magic_waits_total", "", float64(ms.Waits))
+	mw.header("hollomand_magic_wait_seconds_total", "counter", "Time spent waiting for a libmagic handle.")
+	mw.sample("hollomand_magic_wait_seconds_total", "", ms.WaitTime.Seconds())
+	mw.header("hollomand_magic_wait_max_seconds", "gauge", "Longest wait for a libmagic handle.")
+	mw.sample("hollomand_magic_wait_max_seconds", "", ms.MaxWait.Seconds())
+
+	mw.header("hollomand_index_entries", "gauge", "Identifiers in the search index.")
+	mw.sample("hollomand_index_entries", "", float64(m.hs.index.Len()))
+	if m.hs.store != nil {
+		mw.header("hollomand_store_records", "gauge", "Records in the store.")
+		mw.sample("hollomand_store_records", "", float64(m.hs.store.Len()))
+	}
+}
+
+// restMetrics serves the metrics to Prometheus
+func restMetrics(hs *HollomanServer) http.Handler {
+
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		hs.metrics.write(&buf)
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write(buf.Bytes())
+	}
+
+	return http.HandlerFunc(fn)
+}
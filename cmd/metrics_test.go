@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	hh "github.com/wessorh/HuntingHash"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var sampleLine = regexp.MustCompile(`^([a-z_]+)(\{[^}]*\})? (\S+)$`)
+
+// scrape returns the samples of the metrics page by name and labels, it
+// fails on lines that are not in the text exposition format
+func scrape(t *testing.T, url string) map[string]float64 {
+	t.Helper()
+
+	rsp, err := http.Get(url + METRICS_PATH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+	if ct := rsp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("content type %q", ct)
+	}
+	body, _ := io.ReadAll(rsp.Body)
+
+	samples := make(map[string]float64)
+	typed := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if f := strings.Fields(line); len(f) == 4 && f[0] == "#" && f[1] == "TYPE" {
+			typed[f[2]] = f[3]
+			continue
+		}
+		if strings.HasPrefix(line, "# HELP ") {
+			continue
+		}
+		m := sampleLine.FindStringSubmatch(line)
+		if m == nil {
+			t.Fatalf("not a sample: %q", line)
+		}
+		name := m[1]
+		base := strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(name, "_bucket"), "_sum"), "_count")
+		if typed[name] == "" && typed[base] != "histogram" {
+			t.Errorf("%s has no TYPE", name)
+		}
+		v, err := strconv.ParseFloat(m[3], 64)
+		if err != nil {
+			t.Fatalf("%q: %v", line, err)
+		}
+		samples[name+m[2]] = v
+	}
+	return samples
+}
+
+func TestMetricsExposition(t *testing.T) {
+	hs := newTestServer(t)
+	client := startGRPC(t, hs)
+	srv := httptest.NewServer(restHandler(hs))
+	defer srv.Close()
+
+	// two buffers hashed, one too small and one too large for the curve
+	for _, n := range []int{1000, 5000} {
+		if _, err := client.ClusterBuffer(randomBuffer(int64(n), n), "buffer"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, n := range []int{10, 1<<16 + 1} {
+		_, err := client.ClusterBuffer(randomBuffer(1, n), "buffer")
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%d byte buffer: %v, want InvalidArgument", n, err)
+		}
+	}
+	if _, err := client.Search(&hh.SearchRequest{Id: "not an identifier"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("search for a bad identifier: %v", err)
+	}
+
+	// a REST pyramid
+	req := uploadRequest(t, srv.URL+"/holloman/v2/hh128", "", randomBuffer(3, 3000))
+	req.URL.RawQuery = "pyramid=true"
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		t.Fatalf("REST status %d", rsp.StatusCode)
+	}
+	rsp, err = http.Get(srv.URL + "/holloman/v2/nothing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+
+	samples := scrape(t, srv.URL)
+	for series, want := range map[string]float64{
+		`hollomand_requests_total{protocol="grpc",method="/holloman.Holloman/ClusterBuffer",code="OK"}`:              2,
+		`hollomand_requests_total{protocol="grpc",method="/holloman.Holloman/ClusterBuffer",code="InvalidArgument"}`: 2,
+		`hollomand_requests_total{protocol="grpc",method="/holloman.Holloman/Search",code="InvalidArgument"}`:        1,
+		`hollomand_requests_total{protocol="rest",method="/holloman/v2/hh128",code="200"}`:                           1,
+		`hollomand_requests_total{protocol="rest",method="other",code="404"}`:                                        1,
+		`hollomand_errors_total{protocol="grpc",kind="invalid_argument"}`:                                            3,
+		`hollomand_errors_total{protocol="rest",kind="not_found"}`:                                                   1,
+		`hollomand_request_duration_seconds_count{protocol="grpc",method="/holloman.Holloman/ClusterBuffer"}`:        4,
+		`hollomand_requests_in_flight{protocol="grpc"}`:                                                              0,
+		`hollomand_hashed_bytes_total`:                         1000 + 5000 + 3000,
+		`hollomand_hashed_buffers_total`:                       3,
+		`hollomand_curve_order_count`:                          3,
+		`hollomand_curve_order_bucket{le="5"}`:                 1,
+		`hollomand_curve_order_bucket{le="6"}`:                 2,
+		`hollomand_curve_order_bucket{le="7"}`:                 3,
+		`hollomand_hash_stage_seconds_count{stage="resample"}`: 3,
+		`hollomand_hash_stage_seconds_count{stage="magic"}`:    3,
+		`hollomand_hash_stage_seconds_count{stage="pyramid"}`:  1,
+		`hollomand_index_entries`:                              0,
+	} {
+		if got, ok := samples[series]; !ok || got != want {
+			t.Errorf("%s = %v (present %v), want %v", series, got, ok, want)
+		}
+	}
+
+	// buckets are cumulative and +Inf holds every observation
+	var last float64
+	for _, le := range []string{"1", "2", "3", "4", "5", "6", "7", "8", "+Inf"} {
+		v := samples[`hollomand_curve_order_bucket{le="`+le+`"}`]
+		if v < last {
+			t.Errorf("bucket le=%s holds %v, less than the one before", le, v)
+		}
+		last = v
+	}
+	if last != samples["hollomand_curve_order_count"] {
+		t.Errorf("+Inf bucket %v, count %v", last, samples["hollomand_curve_order_count"])
+	}
+}
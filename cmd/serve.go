@@ -0,0 +1,244 @@
+package main
+
+//
+// Copyright 2025 (c) By Rick Wesson & Support Intelligence, Inc.
+// Licenced under the RLL 1.0
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	hh "github.com/wessorh/HuntingHash"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+var shutdownTimeout time.Duration
+
+// listener is a protocol hollomand serves. Every listener shares one
+// HollomanServer, they are bound together before any serves and stopped
+// together.
+type listener interface {
+	String() string               // the protocol and address, for the log
+	Serve() error                 // blocks until Shutdown
+	Shutdown(ctx context.Context) // finishes the requests in progress unless ctx ends first
+}
+
+type grpcListener struct {
+	lis net.Listener
+	srv *grpc.Server
+	tls bool
+}
+
+// scheme names a protocol for the log
+func scheme(protocol string, tls bool) string {
+	if tls {
+		return protocol + " tls"
+	}
+	return protocol
+}
+
+func newGRPCListener(hs *HollomanServer, address string, certs *certReloader) (listener, error) {
+	lis, err := netListen(address)
+	if err != nil {
+		return nil, fmt.Errorf("grpc: %w", err)
+	}
+	opts := []grpc.ServerOption{grpc.MaxRecvMsgSize(1024 * 10e7), grpc.MaxSendMsgSize(1024 * 10e7), withServerUnaryInterceptor(), withServerStreamInterceptor()}
+	if config := serverTLSConfig(certs, []string{"h2"}); config != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(config)))
+	}
+	// metrics come first so they count the requests tokens refuse
+	unary := []grpc.UnaryServerInterceptor{hs.metrics.unaryInterceptor}
+	stream := []grpc.StreamServerInterceptor{hs.metrics.streamInterceptor}
+	if hs.tokens != nil {
+		unary = append(unary, hs.tokens.unaryInterceptor)
+		stream = append(stream, hs.tokens.streamInterceptor)
+	}
+	opts = append(opts, grpc.ChainUnaryInterceptor(unary...), grpc.ChainStreamInterceptor(stream...))
+	s := grpc.NewServer(opts...)
+	hh.RegisterHollomanServer(s, hs)
+	return &grpcListener{lis: lis, srv: s, tls: certs != nil}, nil
+}
+
+func (l *grpcListener) String() string { return scheme("grpc", l.tls) + " " + l.lis.Addr().String() }
+func (l *grpcListener) Serve() error   { return l.srv.Serve(l.lis) }
+
+func (l *grpcListener) Shutdown(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		l.srv.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		l.srv.Stop()
+	}
+	l.lis.Close()
+}
+
+type restListener struct {
+	lis net.Listener
+	srv *http.Server
+	tls bool
+}
+
+// restHandler routes the REST API, behind bearer tokens with -tokens, and
+// the metrics, which Prometheus scrapes without a token
+func restHandler(hs *HollomanServer) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/holloman/v2/capabilities", restCapabilities(hs))
+	mux.Handle("/holloman/v2/hh128", restClusterBuffer(hs))
+	mux.Handle("/holloman/v2/batch", restClusterBatch(hs))
+	mux.Handle("/holloman/v2/stats", restStats(hs))
+	mux.Handle(METRICS_PATH, restMetrics(hs))
+
+	var h http.Handler = mux
+	if hs.tokens != nil {
+		h = hs.tokens.restAuthenticate(mux, METRICS_PATH)
+	}
+	return hs.metrics.instrument(mux, h)
+}
+
+func newRESTListener(hs *HollomanServer, address string, certs *certReloader) (listener, error) {
+	lis, err := netListen(address)
+	if err != nil {
+		return nil, fmt.Errorf("rest: %w", err)
+	}
+	srv := &http.Server{
+		Handler:   restHandler(hs),
+		TLSConfig: serverTLSConfig(certs, []string{"h2", "http/1.1"}),
+	}
+	return &restListener{lis: lis, srv: srv, tls: certs != nil}, nil
+}
+
+func (l *restListener) String() string { return scheme("rest", l.tls) + " " + l.lis.Addr().String() }
+
+func (l *restListener) Serve() error {
+	var err error
+	if l.tls {
+		// the certificate comes from TLSConfig
+		err = l.srv.ServeTLS(l.lis, "", "")
+	} else {
+		err = l.srv.Serve(l.lis)
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (l *restListener) Shutdown(ctx context.Context) {
+	if err := l.srv.Shutdown(ctx); err != nil {
+		l.srv.Close()
+	}
+	l.lis.Close()
+}
+
+// listen binds the gRPC and REST listeners whose address is set, over TLS
+// with -tls-cert, when one fails those already bound are closed
+func listen(hs *HollomanServer, grpcAddress, restAddress string) (listeners []listener, err error) {
+	certs, err := newCertReloader(tlsOpts)
+	if err != nil {
+		return nil, err
+	}
+	bind := []struct {
+		address string
+		open    func(*HollomanServer, string, *certReloader) (listener, error)
+	}{
+		{grpcAddress, newGRPCListener},
+		{restAddress, newRESTListener},
+	}
+	for _, b := range bind {
+		if len(b.address) == 0 {
+			continue
+		}
+		l, err := b.open(hs, b.address, certs)
+		if err != nil {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			for _, l := range listeners {
+				l.Shutdown(ctx)
+			}
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	if len(listeners) == 0 {
+		return nil, fmt.Errorf("nothing to serve, set -grpc or -rest-port")
+	}
+	return listeners, nil
+}
+
+// serve runs the listeners until one fails or hollomand is sent SIGINT or
+// SIGTERM, then shuts every listener down together, giving requests in
+// progress shutdownTimeout to finish, and closes the server once every
+// listener has stopped serving
+func serve(hs *HollomanServer, listeners []listener) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	failed := make(chan error, len(listeners))
+	for _, l := range listeners {
+		log.Info().Msgf("serving %s", l)
+		go func() {
+			if err := l.Serve(); err != nil {
+				failed <- fmt.Errorf("%s: %w", l, err)
+				return
+			}
+			failed <- nil
+		}()
+	}
+
+	var err error
+	serving := len(listeners)
+	select {
+	case <-ctx.Done():
+		log.Info().Msg("shutting down")
+	case err = <-failed:
+		serving--
+		if err == nil {
+			err = fmt.Errorf("a listener stopped")
+		}
+	}
+
+	sctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, l := range listeners {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.Shutdown(sctx)
+		}()
+	}
+	wg.Wait()
+	// the server is only closed once no listener can reach it
+	for ; serving > 0; serving-- {
+		<-failed
+	}
+	if cerr := hs.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Close releases the store and the hasher
+func (server *HollomanServer) Close() (err error) {
+	if server.store != nil {
+		err = server.store.Close()
+	}
+	if herr := server.hasher.Close(); herr != nil && err == nil {
+		err = herr
+	}
+	return err
+}
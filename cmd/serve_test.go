@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowListener serves until it is shut down and only finishes its
+// shutdown when ctx ends, as a listener with a request that never does
+type slowListener struct {
+	stop     chan struct{}
+	fail     error
+	returned *atomic.Int32
+}
+
+func (l *slowListener) String() string { return "slow" }
+
+func (l *slowListener) Serve() error {
+	defer l.returned.Add(1)
+	if l.fail != nil {
+		return l.fail
+	}
+	<-l.stop
+	// a Serve still returning after Shutdown must not see a closed server
+	time.Sleep(50 * time.Millisecond)
+	return nil
+}
+
+func (l *slowListener) Shutdown(ctx context.Context) {
+	<-ctx.Done()
+	close(l.stop)
+}
+
+func TestServeShutsListenersDownTogether(t *testing.T) {
+	hs := newTestServer(t)
+	defer func(d time.Duration) { shutdownTimeout = d }(shutdownTimeout)
+	shutdownTimeout = 300 * time.Millisecond
+
+	var returned atomic.Int32
+	failure := errors.New("accept failed")
+	listeners := []listener{
+		&slowListener{stop: make(chan struct{}), returned: &returned},
+		&slowListener{stop: make(chan struct{}), returned: &returned},
+		&slowListener{stop: make(chan struct{}), fail: failure, returned: &returned},
+	}
+
+	start := time.Now()
+	err := serve(hs, listeners)
+	elapsed := time.Since(start)
+	if !errors.Is(err, failure) {
+		t.Fatalf("serve = %v, want %v", err, failure)
+	}
+	if n := returned.Load(); n != int32(len(listeners)) {
+		t.Fatalf("serve returned with %d of %d listeners still serving", int32(len(listeners))-n, len(listeners))
+	}
+	// one after the other the two slow listeners take twice the timeout
+	if elapsed >= 2*shutdownTimeout {
+		t.Fatalf("shutdown took %s, the listeners were not shut down together", elapsed)
+	}
+}
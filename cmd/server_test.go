@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"testing"
+
+	"github.com/rs/zerolog"
+	hh "github.com/wessorh/HuntingHash"
+)
+
+// newTestServer returns a server hashing with the signature classifier on a
+// computed curve of order 8, buffers up to 64 KiB
+func newTestServer(t *testing.T) *HollomanServer {
+	t.Helper()
+
+	curve, err := hh.NewComputedHilbertCurve(8, hh.CURVE_GRAY, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zerolog.SetGlobalLevel(zerolog.WarnLevel)
+	classifierName = "signature"
+	hs, err := NewServer(curve, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { hs.hasher.Close() })
+	return hs
+}
+
+// startGRPC serves hs over gRPC on a loopback port and returns a client
+func startGRPC(t *testing.T, hs *HollomanServer) *HollomanClient {
+	t.Helper()
+
+	l, err := newGRPCListener(hs, "127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go l.Serve()
+	t.Cleanup(func() { l.Shutdown(context.Background()) })
+
+	client, err := NewHollomanClient(l.(*grpcListener).lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// randomBuffer returns n reproducible random bytes
+func randomBuffer(seed int64, n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(b)
+	return b
+}
+
+// uploadRequest builds the multipart form the REST API takes, a holloman-data
+// file per buffer
+func uploadRequest(t *testing.T, url, token string, buffers ...[]byte) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for i, b := range buffers {
+		fw, err := mw.CreateFormFile("holloman-data", string(rune('a'+i))+".bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(b)
+	}
+	mw.Close()
+
+	req, err := http.NewRequest(http.MethodPost, url, &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
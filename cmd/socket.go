@@ -0,0 +1,121 @@
+package main
+
+//
+// Copyright 2025 (c) By Rick Wesson & Support Intelligence, Inc.
+// Licenced under the RLL 1.0
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	socketMode  string // octal permissions of unix sockets
+	socketOwner string // user[:group] owning unix sockets
+)
+
+// unixSocket returns the path of a unix socket address: one holding a slash,
+// such as /run/hollomand.sock or ./hh.sock, or prefixed with unix:
+func unixSocket(address string) (string, bool) {
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		return path, true
+	}
+	return address, strings.Contains(address, "/")
+}
+
+// netListen listens on a tcp address or a unix socket. A socket left behind
+// by a process that is gone is removed first, the new socket gets
+// -socket-mode and -socket-owner.
+func netListen(address string) (net.Listener, error) {
+	path, ok := unixSocket(address)
+	if !ok {
+		return net.Listen("tcp", address)
+	}
+
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := setSocketAccess(path); err != nil {
+		lis.Close()
+		return nil, err
+	}
+	return lis, nil
+}
+
+// removeStaleSocket removes the socket at path unless something answers on
+// it, any other kind of file is left alone
+func removeStaleSocket(path string) error {
+	st, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if st.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use by another process", path)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return os.Remove(path)
+}
+
+func setSocketAccess(path string) error {
+	mode, err := strconv.ParseUint(socketMode, 8, 32)
+	if err != nil || mode > 0777 {
+		return fmt.Errorf("-socket-mode %q is not an octal permission", socketMode)
+	}
+	if err := os.Chmod(path, os.FileMode(mode)); err != nil {
+		return err
+	}
+	if len(socketOwner) == 0 {
+		return nil
+	}
+
+	uid, gid := -1, -1
+	name, group, _ := strings.Cut(socketOwner, ":")
+	if len(name) > 0 {
+		u, err := user.Lookup(name)
+		if err != nil {
+			return err
+		}
+		if uid, err = strconv.Atoi(u.Uid); err != nil {
+			return err
+		}
+	}
+	if len(group) > 0 {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			return err
+		}
+		if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return err
+		}
+	}
+	return os.Lchown(path, uid, gid)
+}
+
+// grpcTarget turns an address into a gRPC dial target
+func grpcTarget(address string) string {
+	if path, ok := unixSocket(address); ok {
+		return "unix:" + path
+	}
+	return address
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnixSocketAddresses(t *testing.T) {
+	for _, tc := range []struct {
+		address, path, target string
+		unix                  bool
+	}{
+		{"/run/hollomand.sock", "/run/hollomand.sock", "unix:/run/hollomand.sock", true},
+		{"./hh.sock", "./hh.sock", "unix:./hh.sock", true},
+		{"unix:hh.sock", "hh.sock", "unix:hh.sock", true},
+		{"localhost:9000", "localhost:9000", "localhost:9000", false},
+		{":9000", ":9000", ":9000", false},
+	} {
+		path, unix := unixSocket(tc.address)
+		if path != tc.path || unix != tc.unix {
+			t.Errorf("unixSocket(%q) = %q, %v", tc.address, path, unix)
+		}
+		if target := grpcTarget(tc.address); target != tc.target {
+			t.Errorf("grpcTarget(%q) = %q, want %q", tc.address, target, tc.target)
+		}
+	}
+}
+
+func TestNetListenUnix(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hh.sock")
+
+	lis, err := netListen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Mode()&os.ModeSocket == 0 || st.Mode().Perm() != 0660 {
+		t.Fatalf("socket mode %s, want a 0660 socket", st.Mode())
+	}
+
+	// a socket something answers on is not taken over
+	if _, err := netListen(path); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Fatalf("listening on a socket in use: %v", err)
+	}
+
+	// one left behind by a process that is gone is
+	lis.(*net.UnixListener).SetUnlinkOnClose(false)
+	lis.Close()
+	if _, err := os.Lstat(path); err != nil {
+		t.Fatal(err)
+	}
+	lis, err = netListen(path)
+	if err != nil {
+		t.Fatalf("a stale socket was not replaced: %v", err)
+	}
+	lis.Close()
+
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := netListen(file); err == nil {
+		t.Fatal("a regular file was replaced by a socket")
+	}
+}
+
+func TestSocketAccess(t *testing.T) {
+	defer func(m, o string) { socketMode, socketOwner = m, o }(socketMode, socketOwner)
+	path := filepath.Join(t.TempDir(), "hh.sock")
+
+	socketMode = "0600"
+	me, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	socketOwner = me.Username
+	lis, err := netListen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis.Close()
+
+	socketOwner = ""
+	for _, mode := range []string{"rw", "1777", "0999"} {
+		socketMode = mode
+		if lis, err := netListen(path); err == nil {
+			lis.Close()
+			t.Fatalf("-socket-mode %s was accepted", mode)
+		}
+		if _, err := os.Lstat(path); err == nil {
+			t.Fatalf("-socket-mode %s left the socket behind", mode)
+		}
+	}
+
+	socketMode, socketOwner = "0660", "no-such-user-hh"
+	if lis, err := netListen(path); err == nil {
+		lis.Close()
+		t.Fatal("an unknown -socket-owner was accepted")
+	}
+}
+
+func TestServeOverUnixSockets(t *testing.T) {
+	hs := newTestServer(t)
+	dir := t.TempDir()
+
+	g, err := newGRPCListener(hs, filepath.Join(dir, "grpc.sock"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go g.Serve()
+	defer g.Shutdown(context.Background())
+
+	client, err := NewHollomanClient(filepath.Join(dir, "grpc.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.GetCapabilities("", 0); err != nil {
+		t.Fatalf("gRPC over a unix socket: %v", err)
+	}
+
+	restPath := "unix:" + filepath.Join(dir, "rest.sock")
+	r, err := newRESTListener(hs, restPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go r.Serve()
+	defer r.Shutdown(context.Background())
+
+	hc := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", filepath.Join(dir, "rest.sock"))
+		},
+	}}
+	rsp, err := hc.Get("http://hollomand/holloman/v2/capabilities")
+	if err != nil {
+		t.Fatalf("REST over a unix socket: %v", err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		t.Fatalf("REST over a unix socket: %s", rsp.Status)
+	}
+}
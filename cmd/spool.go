@@ -0,0 +1,265 @@
+package main
+
+//
+// Copyright 2025 (c) By Rick Wesson & Support Intelligence, Inc.
+// Licenced under the RLL 1.0
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// spoolOptions configure -spool, the inbox hollomand consumes
+type spoolOptions struct {
+	done   string        // processed files are moved here, inbox/done when empty
+	failed string        // files that could not be hashed, inbox/failed when empty
+	out    string        // results are appended to this file, - for stdout
+	settle time.Duration // a file unchanged this long is complete
+	poll   time.Duration // rescan interval
+}
+
+var spoolOpts spoolOptions
+
+// spoolFile is the size and modification time of a file last seen in the inbox
+type spoolFile struct {
+	size  int64
+	mtime time.Time
+}
+
+// spool hashes the files dropped into inbox once each and moves them to the
+// done or failed directory. Files are queued as soon as the watcher reports
+// them written, and by a rescan once they stopped changing, which catches
+// files written while hollomand was down or by writers the watcher misses.
+type spool struct {
+	inbox string
+	opts  spoolOptions
+	hash  hashFunc
+	out   *resultWriter
+
+	mu       sync.Mutex
+	seen     map[string]spoolFile // by the rescans, to tell when a file settled
+	inflight map[string]bool      // queued or being hashed
+	stuck    map[string]spoolFile // hashed but not moved out, skipped until they change
+	ready    chan string
+}
+
+// spoolDirectory runs the spool until SIGINT or SIGTERM, files being hashed
+// are finished first
+func spoolDirectory(inbox string, opts spoolOptions, workers int, hash hashFunc, line lineFunc) error {
+	if st, err := os.Stat(inbox); err != nil {
+		return err
+	} else if !st.IsDir() {
+		return fmt.Errorf("%s is not a directory", inbox)
+	}
+	if opts.done == "" {
+		opts.done = filepath.Join(inbox, "done")
+	}
+	if opts.failed == "" {
+		opts.failed = filepath.Join(inbox, "failed")
+	}
+	for _, d := range []string{opts.done, opts.failed} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return err
+		}
+	}
+	if opts.settle <= 0 {
+		return fmt.Errorf("-spool-settle must be positive")
+	}
+	if opts.poll <= 0 {
+		opts.poll = opts.settle
+	}
+
+	out, header := os.Stdout, true
+	if opts.out != "-" && opts.out != "" {
+		f, err := os.OpenFile(opts.out, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+
+		// a file appended to across runs has its header already
+		st, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		header = st.Size() == 0
+	}
+
+	s := &spool{
+		inbox:    inbox,
+		opts:     opts,
+		hash:     hash,
+		out:      newResultWriter(out, outputFormat, line, header),
+		seen:     make(map[string]spoolFile),
+		inflight: make(map[string]bool),
+		stuck:    make(map[string]spoolFile),
+		ready:    make(chan string, max(workers, 1)),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var wg sync.WaitGroup
+	for w := 0; w < max(workers, 1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range s.ready {
+				s.process(path)
+			}
+		}()
+	}
+
+	log.Info().Msgf("spooling %s, done %s, failed %s", inbox, opts.done, opts.failed)
+	err := s.watch(ctx)
+	close(s.ready)
+	wg.Wait()
+	return err
+}
+
+// candidate reports whether name in the inbox should be hashed, dot files
+// are left for writers to stage into place
+func (s *spool) candidate(name string) (os.FileInfo, bool) {
+	if strings.HasPrefix(name, ".") {
+		return nil, false
+	}
+	st, err := os.Lstat(filepath.Join(s.inbox, name))
+	if err != nil || !st.Mode().IsRegular() {
+		return nil, false
+	}
+	return st, true
+}
+
+// enqueue queues name unless it is queued already or could not be moved
+// out of the inbox and has not changed since
+func (s *spool) enqueue(ctx context.Context, name string, st os.FileInfo) {
+	path := filepath.Join(s.inbox, name)
+	s.mu.Lock()
+	if s.inflight[path] {
+		s.mu.Unlock()
+		return
+	}
+	if last, ok := s.stuck[path]; ok {
+		if last == (spoolFile{size: st.Size(), mtime: st.ModTime()}) {
+			s.mu.Unlock()
+			return
+		}
+		delete(s.stuck, path)
+	}
+	s.inflight[path] = true
+	delete(s.seen, path)
+	s.mu.Unlock()
+
+	select {
+	case s.ready <- path:
+	case <-ctx.Done():
+	}
+}
+
+// rescan queues the files that have not changed since the last rescan and
+// are older than the settle time
+func (s *spool) rescan(ctx context.Context) {
+	entries, err := os.ReadDir(s.inbox)
+	if err != nil {
+		log.Error().Msg(err.Error())
+		return
+	}
+	present := make(map[string]bool)
+	for _, e := range entries {
+		st, ok := s.candidate(e.Name())
+		if !ok {
+			continue
+		}
+		path := filepath.Join(s.inbox, e.Name())
+		present[path] = true
+
+		now := spoolFile{size: st.Size(), mtime: st.ModTime()}
+		s.mu.Lock()
+		last, known := s.seen[path]
+		s.seen[path] = now
+		s.mu.Unlock()
+		if known && last == now && time.Since(now.mtime) >= s.opts.settle {
+			s.enqueue(ctx, e.Name(), st)
+		}
+	}
+
+	s.mu.Lock()
+	for path := range s.seen {
+		if !present[path] {
+			delete(s.seen, path)
+		}
+	}
+	for path := range s.stuck {
+		if !present[path] {
+			delete(s.stuck, path)
+		}
+	}
+	s.mu.Unlock()
+}
+
+// process hashes path, writes the result and moves the file out of the inbox
+func (s *spool) process(path string) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.inflight, path)
+		s.mu.Unlock()
+	}()
+
+	st, err := os.Stat(path)
+	if err != nil {
+		// taken out of the inbox by someone else
+		log.Debug().Msgf("%s: %v", path, err)
+		return
+	}
+	rsp, err := s.hash(dirFile{path: path, size: st.Size()})
+	res := dirResult{BufferResponse: rsp, Path: path}
+	dest := s.opts.done
+	if err != nil {
+		res.Error = err.Error()
+		dest = s.opts.failed
+	}
+	if err := s.out.write(res); err != nil {
+		// leave the file to be hashed again rather than lose its result
+		log.Error().Msgf("%s: writing result: %v", path, err)
+		return
+	}
+
+	moved, err := moveInto(path, dest)
+	if err != nil && dest != s.opts.failed {
+		log.Error().Msgf("%s: %v, moving it to %s", path, err, s.opts.failed)
+		moved, err = moveInto(path, s.opts.failed)
+	}
+	if err != nil {
+		// its result is written, hashing it again would only repeat it
+		log.Error().Msgf("%s: %v, skipped until it changes", path, err)
+		s.mu.Lock()
+		s.stuck[path] = spoolFile{size: st.Size(), mtime: st.ModTime()}
+		s.mu.Unlock()
+		return
+	}
+	log.Debug().Msgf("%s -> %s", path, moved)
+}
+
+// moveInto renames path into dir, a suffix keeps files of the same name apart
+func moveInto(path, dir string) (string, error) {
+	base := filepath.Base(path)
+	dest := filepath.Join(dir, base)
+	for i := 1; ; i++ {
+		// any error but a file of that name is left for Rename to report
+		if _, err := os.Lstat(dest); err != nil {
+			break
+		}
+		dest = filepath.Join(dir, fmt.Sprintf("%s.%d", base, i))
+	}
+	return dest, os.Rename(path, dest)
+}
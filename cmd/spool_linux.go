@@ -0,0 +1,85 @@
+package main
+
+//
+// Copyright 2025 (c) By Rick Wesson & Support Intelligence, Inc.
+// Licenced under the RLL 1.0
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/rs/zerolog/log"
+)
+
+// watch queues the files inotify reports closed after writing or moved into
+// the inbox, a rescan every poll interval picks up the rest
+func (s *spool) watch(ctx context.Context) error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return fmt.Errorf("inotify: %w", err)
+	}
+	// a non blocking descriptor is read through the runtime poller, so
+	// closing it ends a pending read
+	events := os.NewFile(uintptr(fd), "inotify")
+	if _, err := syscall.InotifyAddWatch(fd, s.inbox, syscall.IN_CLOSE_WRITE|syscall.IN_MOVED_TO); err != nil {
+		events.Close()
+		return fmt.Errorf("inotify %s: %w", s.inbox, err)
+	}
+
+	names := make(chan string)
+	go func() {
+		defer close(names)
+		buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+		for {
+			n, err := events.Read(buf)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Error().Msgf("inotify: %v", err)
+				}
+				return
+			}
+			for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+				ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+				name := buf[off+syscall.SizeofInotifyEvent : off+syscall.SizeofInotifyEvent+int(ev.Len)]
+				off += syscall.SizeofInotifyEvent + int(ev.Len)
+				if ev.Mask&syscall.IN_Q_OVERFLOW != 0 {
+					log.Warn().Msg("inotify queue overflowed, waiting for the rescan")
+					continue
+				}
+				if i := bytes.IndexByte(name, 0); i >= 0 {
+					name = name[:i]
+				}
+				if len(name) > 0 {
+					names <- string(name)
+				}
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(s.opts.poll)
+	defer ticker.Stop()
+	s.rescan(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			events.Close()
+			for range names {
+			}
+			return nil
+		case name, ok := <-names:
+			if !ok {
+				return fmt.Errorf("inotify %s: watch ended", s.inbox)
+			}
+			if st, ok := s.candidate(name); ok {
+				s.enqueue(ctx, name, st)
+			}
+		case <-ticker.C:
+			s.rescan(ctx)
+		}
+	}
+}
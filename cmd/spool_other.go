@@ -0,0 +1,27 @@
+//go:build !linux
+
+package main
+
+//
+// Copyright 2025 (c) By Rick Wesson & Support Intelligence, Inc.
+// Licenced under the RLL 1.0
+
+import (
+	"context"
+	"time"
+)
+
+// watch rescans the inbox every poll interval, files are queued once they
+// stopped changing
+func (s *spool) watch(ctx context.Context) error {
+	ticker := time.NewTicker(s.opts.poll)
+	defer ticker.Stop()
+	for {
+		s.rescan(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
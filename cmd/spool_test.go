@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	hh "github.com/wessorh/HuntingHash"
+)
+
+// newTestSpool spools inbox into done and failed without starting workers,
+// queued paths are left on ready
+func newTestSpool(t *testing.T, inbox, done, failed string, out *bytes.Buffer) *spool {
+	t.Helper()
+
+	hash := func(f dirFile) (*hh.BufferResponse, error) {
+		return &hh.BufferResponse{Len: int32(f.size)}, nil
+	}
+	line := func(path string, rsp *hh.BufferResponse) string { return path }
+	return &spool{
+		inbox:    inbox,
+		opts:     spoolOptions{done: done, failed: failed, settle: time.Nanosecond},
+		hash:     hash,
+		out:      newResultWriter(out, "text", line, false),
+		seen:     make(map[string]spoolFile),
+		inflight: make(map[string]bool),
+		stuck:    make(map[string]spoolFile),
+		ready:    make(chan string, 4),
+	}
+}
+
+// queued drains the paths rescan queued
+func queued(s *spool) (paths []string) {
+	for {
+		select {
+		case p := <-s.ready:
+			paths = append(paths, p)
+		default:
+			return paths
+		}
+	}
+}
+
+// settled rescans twice, so unchanged files settle, and returns the queue
+func settled(s *spool) []string {
+	s.rescan(context.Background())
+	time.Sleep(time.Millisecond)
+	s.rescan(context.Background())
+	return queued(s)
+}
+
+func TestSpoolFallsBackToFailed(t *testing.T) {
+	inbox, failed := t.TempDir(), t.TempDir()
+	// a file where the done directory should be makes every move there fail
+	done := filepath.Join(t.TempDir(), "done")
+	if err := os.WriteFile(done, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(inbox, "sample")
+	if err := os.WriteFile(path, []byte("sample"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	s := newTestSpool(t, inbox, done, failed, &out)
+	q := settled(s)
+	if len(q) != 1 || q[0] != path {
+		t.Fatalf("queued %v, want %s", q, path)
+	}
+	s.process(path)
+	if _, err := os.Stat(filepath.Join(failed, "sample")); err != nil {
+		t.Fatalf("not moved to the failed directory: %v", err)
+	}
+	if q := settled(s); len(q) != 0 {
+		t.Fatalf("queued %v after the file was moved", q)
+	}
+}
+
+func TestSpoolSkipsFilesItCannotMove(t *testing.T) {
+	inbox := t.TempDir()
+	done := filepath.Join(t.TempDir(), "done")
+	failed := filepath.Join(t.TempDir(), "failed")
+	for _, d := range []string{done, failed} {
+		if err := os.WriteFile(d, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(inbox, "sample")
+	if err := os.WriteFile(path, []byte("sample"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	s := newTestSpool(t, inbox, done, failed, &out)
+	if q := settled(s); len(q) != 1 {
+		t.Fatalf("queued %v, want %s", q, path)
+	}
+	s.process(path)
+	if n := strings.Count(out.String(), path); n != 1 {
+		t.Fatalf("%d results for %s, want 1", n, path)
+	}
+
+	for range 3 {
+		if q := settled(s); len(q) != 0 {
+			t.Fatalf("queued %v again though it has not changed", q)
+		}
+	}
+
+	// a file rewritten in place is new
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+	s.opts.settle = -time.Hour
+	if q := settled(s); len(q) != 1 || q[0] != path {
+		t.Fatalf("queued %v after the file changed, want %s", q, path)
+	}
+}
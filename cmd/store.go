@@ -0,0 +1,96 @@
+package main
+
+//
+// Copyright 2025 (c) By Rick Wesson & Support Intelligence, Inc.
+// Licenced under the RLL 1.0
+
+import (
+	"time"
+
+	"github.com/rs/zerolog/log"
+	hh "github.com/wessorh/HuntingHash"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// openStore opens the persistent store in dir and restores the similarity
+// index from the records that were indexed.
+func (server *HollomanServer) openStore(dir string, sync bool) (err error) {
+	server.store, err = hh.OpenStore(dir)
+	if err != nil {
+		return err
+	}
+	server.store.SyncWrites = sync
+
+	indexed := 0
+	server.store.Range(func(rec hh.StoreRecord) bool {
+		if !rec.Indexed {
+			return true
+		}
+		ids, err := rec.Identifiers()
+		if err != nil {
+			log.Error().Msgf("store record %s: %v", rec.Sha1, err)
+			return true
+		}
+		for _, id := range ids {
+			server.index.Insert(hh.IndexEntry{Id: id, Label: rec.Label, Sha1: rec.Sha1})
+		}
+		indexed++
+		return true
+	})
+	log.Info().Msgf("loaded %d records from %s, %d indexed", server.store.Len(), dir, indexed)
+	return nil
+}
+
+// hash clusters the buffer of req and records the result in the store, when
+// there is one
+func (server *HollomanServer) hash(req *hh.BufferRequest, indexed bool) (*hh.Result, error) {
+
+	opts, err := server.options(req.Pyramid, req.Filter)
+	if err != nil {
+		return nil, invalidArgument(err)
+	}
+	res, err := server.hasher.HashBytesOptions(req.Buffer, req.Label, opts)
+	if err != nil {
+		return nil, invalidArgument(err)
+	}
+	server.record(res, indexed)
+	return res, nil
+}
+
+// invalidArgument is the status of a request the hasher refused: a buffer
+// too small or too large for the curve, an unknown filter or identifier. A
+// status is returned as it is.
+func invalidArgument(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Error(codes.InvalidArgument, err.Error())
+}
+
+// options are the hasher defaults with what a request asks for, an empty
+// filter is the server default
+func (server *HollomanServer) options(pyramid bool, filter string) (hh.HashOptions, error) {
+	opts := server.hasher.HashOptions
+	opts.Pyramid = opts.Pyramid || pyramid
+	if len(filter) > 0 {
+		f, err := hh.ParseResampleFilter(filter)
+		if err != nil {
+			return opts, err
+		}
+		opts.Filter = f
+	}
+	return opts, nil
+}
+
+// record counts a result and adds it to the store, when there is one
+func (server *HollomanServer) record(res *hh.Result, indexed bool) {
+	server.metrics.result(res)
+	if server.store != nil {
+		rec := hh.NewStoreRecord(res, time.Now().UTC())
+		rec.Indexed = indexed
+		if _, err := server.store.Put(rec); err != nil {
+			log.Error().Msgf("store: %v", err)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+//
+// Copyright 2025 (c) By Rick Wesson & Support Intelligence, Inc.
+// Licenced under the RLL 1.0
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	hh "github.com/wessorh/HuntingHash"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	STREAM_CHUNK_LEN = 1 << 20 // bytes per BufferChunk
+	STREAM_ABOVE     = 4 << 20 // client mode streams files larger than this
+)
+
+// ClusterStream receives a buffer in chunks and maps them onto the curve as
+// they arrive
+func (server *HollomanServer) ClusterStream(stream hh.Holloman_ClusterStreamServer) error {
+	var hs *hh.HashStream
+
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if hs == nil {
+			hs, err = server.hasher.NewStream(chunk.Length, chunk.Label)
+			if err != nil {
+				return invalidArgument(err)
+			}
+			hs.Options, err = server.options(chunk.Pyramid, chunk.Filter)
+			if err != nil {
+				return invalidArgument(err)
+			}
+		}
+		if _, err := hs.Write(chunk.Chunk); err != nil {
+			return invalidArgument(err)
+		}
+	}
+	if hs == nil {
+		return status.Error(codes.InvalidArgument, "stream carried no chunks")
+	}
+
+	res, err := hs.Sum()
+	if err != nil {
+		return invalidArgument(err)
+	}
+	server.record(res, false)
+
+	return stream.SendAndClose(toBufferResponse(res))
+}
+
+func streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) (err error) {
+	if *verbose {
+		start := time.Now()
+		err = handler(srv, ss)
+
+		log.Info().Msgf("Request - Method:%s\tDuration:%s\t\tError:%v",
+			info.FullMethod, time.Since(start), err)
+	} else {
+		err = handler(srv, ss)
+	}
+	return err
+}
+
+func withServerStreamInterceptor() grpc.ServerOption {
+	return grpc.StreamInterceptor(streamInterceptor)
+}
+
+// ClusterStream sends length bytes read from r in chunks to the ClusterStream RPC
+func (c *HollomanClient) ClusterStream(r io.Reader, length int64, filename string) (*hh.BufferResponse, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := c.client.ClusterStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, STREAM_CHUNK_LEN)
+	first := true
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			chunk := &hh.BufferChunk{Chunk: buf[:n]}
+			if first {
+				chunk.Label = filename
+				chunk.Length = length
+				chunk.Pyramid = *pyramid
+				chunk.Filter = filterName
+				first = false
+			}
+			if err := stream.Send(chunk); err == io.EOF {
+				// the server ended the stream, its status says why
+				return stream.CloseAndRecv()
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return stream.CloseAndRecv()
+}
@@ -0,0 +1,237 @@
+package main
+
+//
+// Copyright 2025 (c) By Rick Wesson & Support Intelligence, Inc.
+// Licenced under the RLL 1.0
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// tlsOptions are the -tls flags. The certificate and key are the server's
+// in the serving modes and the client certificate in client mode.
+type tlsOptions struct {
+	cert, key  string
+	clientCA   string      // server: require client certificates issued by these CAs
+	allowed    subjectList // server: client subjects accepted, globs
+	ca         string      // client: CAs of the server, the system roots when empty
+	serverName string      // client: name verified in the server certificate
+	enable     bool        // client: TLS with the system roots
+}
+
+var tlsOpts tlsOptions
+
+// subjectList is a repeated flag of globs, distinguished names hold commas
+// so unlike stringList a value is not split. The globs follow path.Match on
+// every platform: * and ? stop at a slash, so a URI name is matched segment
+// by segment, and a backslash escapes.
+type subjectList []string
+
+func (l *subjectList) String() string { return strings.Join(*l, ";") }
+
+func (l *subjectList) Set(value string) error {
+	if _, err := path.Match(value, ""); err != nil {
+		return fmt.Errorf("%q: %w", value, err)
+	}
+	*l = append(*l, value)
+	return nil
+}
+
+// TLS_RELOAD_CHECK is how often, at most, the certificate files are checked
+// for changes
+const TLS_RELOAD_CHECK = time.Second
+
+// certReloader holds the server certificate and the client CAs, it loads
+// them again when a handshake finds the files changed so certificates can
+// be renewed without a restart
+type certReloader struct {
+	opts tlsOptions
+
+	mu      sync.Mutex
+	checked time.Time
+	stamp   string
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+}
+
+// fileStamp identifies the content of the files by size and modification time
+func (r *certReloader) fileStamp() (string, error) {
+	stamp := ""
+	for _, name := range []string{r.opts.cert, r.opts.key, r.opts.clientCA} {
+		if name == "" {
+			continue
+		}
+		st, err := os.Stat(name)
+		if err != nil {
+			return "", err
+		}
+		stamp += fmt.Sprintf("%s:%d:%d;", name, st.Size(), st.ModTime().UnixNano())
+	}
+	return stamp, nil
+}
+
+func (r *certReloader) load() error {
+	stamp, err := r.fileStamp()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.opts.cert, r.opts.key)
+	if err != nil {
+		return err
+	}
+	var pool *x509.CertPool
+	if r.opts.clientCA != "" {
+		if pool, err = loadCertPool(r.opts.clientCA); err != nil {
+			return err
+		}
+	}
+	r.stamp, r.cert, r.pool = stamp, &cert, pool
+	return nil
+}
+
+// current returns the certificate and client CAs, reloaded when the files
+// changed. A reload that fails keeps the previous ones.
+func (r *certReloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checked) >= TLS_RELOAD_CHECK {
+		r.checked = time.Now()
+		if stamp, err := r.fileStamp(); err != nil {
+			log.Error().Msgf("tls: %v", err)
+		} else if stamp != r.stamp {
+			if err := r.load(); err != nil {
+				log.Error().Msgf("tls reload: %v", err)
+			} else {
+				log.Info().Msgf("tls: reloaded %s", r.opts.cert)
+			}
+		}
+	}
+	return r.cert, r.pool
+}
+
+func loadCertPool(filename string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%s holds no PEM certificates", filename)
+	}
+	return pool, nil
+}
+
+// allowedSubject reports whether a glob in allowed matches the common name,
+// the distinguished name or a DNS, email or URI name of cert, with the
+// path.Match semantics of subjectList
+func allowedSubject(allowed []string, cert *x509.Certificate) bool {
+	names := []string{cert.Subject.CommonName, cert.Subject.String()}
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, u := range cert.URIs {
+		names = append(names, u.String())
+	}
+	for _, pattern := range allowed {
+		for _, name := range names {
+			if ok, _ := path.Match(pattern, name); ok && len(name) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// serverTLSConfig returns the TLS configuration of a listener offering
+// nextProtos, nil without -tls-cert. Every handshake takes the current
+// certificate and client CAs.
+func serverTLSConfig(reloader *certReloader, nextProtos []string) *tls.Config {
+	if reloader == nil {
+		return nil
+	}
+	allowed := reloader.opts.allowed
+	config := func() *tls.Config {
+		cert, pool := reloader.current()
+		c := &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{*cert},
+			NextProtos:   nextProtos,
+		}
+		if pool != nil {
+			c.ClientCAs = pool
+			c.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+		if len(allowed) > 0 {
+			c.VerifyConnection = func(cs tls.ConnectionState) error {
+				if len(cs.PeerCertificates) == 0 || !allowedSubject(allowed, cs.PeerCertificates[0]) {
+					return fmt.Errorf("client certificate subject is not allowed")
+				}
+				return nil
+			}
+		}
+		return c
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: nextProtos,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, _ := reloader.current()
+			return cert, nil
+		},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return config(), nil
+		},
+	}
+}
+
+// newCertReloader loads the -tls-cert and -tls-key of the serving modes, it
+// returns nil when TLS is off
+func newCertReloader(opts tlsOptions) (*certReloader, error) {
+	if opts.cert == "" && opts.key == "" {
+		if opts.clientCA != "" || len(opts.allowed) > 0 {
+			return nil, fmt.Errorf("-tls-client-ca and -tls-allowed-subjects need -tls-cert and -tls-key")
+		}
+		return nil, nil
+	}
+	if len(opts.allowed) > 0 && opts.clientCA == "" {
+		return nil, fmt.Errorf("-tls-allowed-subjects needs -tls-client-ca")
+	}
+	r := &certReloader{opts: opts, checked: time.Now()}
+	if err := r.load(); err != nil {
+		return nil, fmt.Errorf("tls: %w", err)
+	}
+	return r, nil
+}
+
+// clientTLSConfig returns the TLS configuration of client mode, nil when
+// none of -tls, -tls-ca and -tls-cert is set
+func clientTLSConfig(opts tlsOptions) (*tls.Config, error) {
+	if !opts.enable && opts.ca == "" && opts.cert == "" {
+		return nil, nil
+	}
+	c := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: opts.serverName}
+	if opts.ca != "" {
+		pool, err := loadCertPool(opts.ca)
+		if err != nil {
+			return nil, err
+		}
+		c.RootCAs = pool
+	}
+	if opts.cert != "" || opts.key != "" {
+		cert, err := tls.LoadX509KeyPair(opts.cert, opts.key)
+		if err != nil {
+			return nil, err
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return c, nil
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// testCA issues certificates for the TLS tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	file string // the CA certificate, PEM
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), name+".pem")
+	writePEM(t, file, "CERTIFICATE", der)
+	return &testCA{cert: cert, key: key, file: file}
+}
+
+func writePEM(t *testing.T, file, kind string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// issue signs a certificate for tmpl and writes it and its key to dir,
+// returning the file names
+func (ca *testCA) issue(t *testing.T, dir string, tmpl *x509.Certificate) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.NotBefore, tmpl.NotAfter = time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kder, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := tmpl.Subject.CommonName
+	certFile, keyFile = filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", kder)
+	return certFile, keyFile
+}
+
+func TestAllowedSubject(t *testing.T) {
+	uri, _ := url.Parse("spiffe://example.org/ns/prod/scanner")
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "scanner-01", Organization: []string{"Hunting"}},
+		DNSNames:       []string{"scanner-01.hunt.example.org"},
+		EmailAddresses: []string{"ops@example.org"},
+		URIs:           []*url.URL{uri},
+	}
+	for _, tc := range []struct {
+		glob string
+		want bool
+	}{
+		{"scanner-*", true},
+		{"CN=scanner-01,O=Hunting", true},
+		{"CN=*,O=Hunting", true},
+		{"*.hunt.example.org", true},
+		{"*@example.org", true},
+		{"spiffe://example.org/ns/prod/*", true},
+		{"spiffe://example.org/*/*/scanner", true},
+		// * stops at a slash
+		{"spiffe://example.org/*", false},
+		{"spiffe://*", false},
+		{"scanner-0?", true},
+		{"other-*", false},
+		{"*.hunt.example.net", false},
+		{`scanner\-01`, true},
+		{"", false},
+	} {
+		if got := allowedSubject([]string{tc.glob}, cert); got != tc.want {
+			t.Errorf("allowedSubject(%q) = %v, want %v", tc.glob, got, tc.want)
+		}
+	}
+
+	var l subjectList
+	if err := l.Set("CN=a,O=b"); err != nil || len(l) != 1 {
+		t.Fatalf("a subject holding commas: %v %v", l, err)
+	}
+	if err := l.Set("[a-"); err == nil {
+		t.Fatal("a malformed glob was accepted")
+	}
+}
+
+func TestNewCertReloaderChecksTheFlags(t *testing.T) {
+	for _, opts := range []tlsOptions{
+		{clientCA: "ca.pem"},
+		{allowed: subjectList{"*"}},
+		{cert: "c", key: "k", allowed: subjectList{"*"}},
+		{cert: filepath.Join(t.TempDir(), "missing"), key: "k"},
+	} {
+		if _, err := newCertReloader(opts); err == nil {
+			t.Errorf("%+v was accepted", opts)
+		}
+	}
+	if r, err := newCertReloader(tlsOptions{}); r != nil || err != nil {
+		t.Fatalf("no TLS flags: %v, %v", r, err)
+	}
+}
+
+// mtlsServer serves the REST API over TLS with client certificates from
+// clientCA, narrowed to allowed, and returns the capabilities URL and the
+// reloader
+func mtlsServer(t *testing.T, serverCA, clientCA *testCA, allowed ...string) (string, *certReloader) {
+	t.Helper()
+
+	dir := t.TempDir()
+	cert, key := serverCA.issue(t, dir, &x509.Certificate{
+		SerialNumber: big.NewInt(2), Subject: pkix.Name{CommonName: "hollomand"}, DNSNames: []string{"hollomand"},
+	})
+	certs, err := newCertReloader(tlsOptions{cert: cert, key: key, clientCA: clientCA.file, allowed: allowed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := newRESTListener(newTestServer(t), "127.0.0.1:0", certs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go l.Serve()
+	t.Cleanup(func() { l.Shutdown(context.Background()) })
+	return "https://" + l.(*restListener).lis.Addr().String() + "/holloman/v2/capabilities", certs
+}
+
+// tlsGet fetches addr presenting the client certificate, if any, and
+// verifying the server against ca
+func tlsGet(t *testing.T, addr string, ca *testCA, cert, key string) error {
+	t.Helper()
+
+	opts := tlsOptions{ca: ca.file, cert: cert, key: key, serverName: "hollomand"}
+	config, err := clientTLSConfig(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hc := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+	rsp, err := hc.Get(addr)
+	if err != nil {
+		return err
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		t.Fatalf("%s: %s", addr, rsp.Status)
+	}
+	return nil
+}
+
+func TestMutualTLS(t *testing.T) {
+	serverCA, clientCA, otherCA := newTestCA(t, "server-ca"), newTestCA(t, "client-ca"), newTestCA(t, "other-ca")
+	addr, _ := mtlsServer(t, serverCA, clientCA, "scanner-*", "spiffe://example.org/*")
+
+	dir := t.TempDir()
+	spiffe, _ := url.Parse("spiffe://example.org/scanner")
+	nested, _ := url.Parse("spiffe://example.org/ns/scanner")
+	allowedCert, allowedKey := clientCA.issue(t, dir, &x509.Certificate{SerialNumber: big.NewInt(3), Subject: pkix.Name{CommonName: "scanner-01"}})
+	uriCert, uriKey := clientCA.issue(t, dir, &x509.Certificate{SerialNumber: big.NewInt(4), Subject: pkix.Name{CommonName: "by-uri"}, URIs: []*url.URL{spiffe}})
+	nestedCert, nestedKey := clientCA.issue(t, dir, &x509.Certificate{SerialNumber: big.NewInt(5), Subject: pkix.Name{CommonName: "nested"}, URIs: []*url.URL{nested}})
+	deniedCert, deniedKey := clientCA.issue(t, dir, &x509.Certificate{SerialNumber: big.NewInt(6), Subject: pkix.Name{CommonName: "laptop"}})
+	foreignCert, foreignKey := otherCA.issue(t, dir, &x509.Certificate{SerialNumber: big.NewInt(7), Subject: pkix.Name{CommonName: "scanner-02"}})
+
+	for _, tc := range []struct {
+		name      string
+		cert, key string
+		ok        bool
+	}{
+		{"allowed common name", allowedCert, allowedKey, true},
+		{"allowed URI", uriCert, uriKey, true},
+		{"URI below the glob", nestedCert, nestedKey, false},
+		{"subject not allowed", deniedCert, deniedKey, false},
+		{"another CA", foreignCert, foreignKey, false},
+		{"no certificate", "", "", false},
+	} {
+		err := tlsGet(t, addr, serverCA, tc.cert, tc.key)
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+	}
+
+	// the server is verified too
+	if err := tlsGet(t, addr, otherCA, allowedCert, allowedKey); err == nil {
+		t.Fatal("a server certificate from an unknown CA was accepted")
+	}
+}
+
+func TestCertificateReload(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	dir := t.TempDir()
+	cert, key := ca.issue(t, dir, &x509.Certificate{SerialNumber: big.NewInt(10), Subject: pkix.Name{CommonName: "hollomand"}})
+	r, err := newCertReloader(tlsOptions{cert: cert, key: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial := func() int64 {
+		c, _ := r.current()
+		x, err := x509.ParseCertificate(c.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return x.SerialNumber.Int64()
+	}
+
+	// renewed in place, picked up once the check interval passed
+	ca.issue(t, dir, &x509.Certificate{SerialNumber: big.NewInt(11), Subject: pkix.Name{CommonName: "hollomand"}})
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(cert, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if got := serial(); got != 10 {
+		t.Fatalf("reloaded before the check interval, serial %d", got)
+	}
+	r.mu.Lock()
+	r.checked = time.Time{}
+	r.mu.Unlock()
+	if got := serial(); got != 11 {
+		t.Fatalf("serial %d after a renewal, want 11", got)
+	}
+
+	// a broken file keeps the previous certificate, and logs why
+	defer zerolog.SetGlobalLevel(zerolog.GlobalLevel())
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	if err := os.WriteFile(key, []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	r.mu.Lock()
+	r.checked = time.Time{}
+	r.mu.Unlock()
+	if got := serial(); got != 11 {
+		t.Fatalf("serial %d after a failed reload, want 11", got)
+	}
+}
+
+func TestGRPCOverTLS(t *testing.T) {
+	defer func(o tlsOptions) { tlsOpts = o }(tlsOpts)
+	ca := newTestCA(t, "ca")
+	dir := t.TempDir()
+	cert, key := ca.issue(t, dir, &x509.Certificate{SerialNumber: big.NewInt(20), Subject: pkix.Name{CommonName: "hollomand"}, DNSNames: []string{"hollomand"}})
+	clientCert, clientKey := ca.issue(t, dir, &x509.Certificate{SerialNumber: big.NewInt(21), Subject: pkix.Name{CommonName: "scanner"}})
+	certs, err := newCertReloader(tlsOptions{cert: cert, key: key, clientCA: ca.file, allowed: subjectList{"scanner"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := newGRPCListener(newTestServer(t), "127.0.0.1:0", certs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go l.Serve()
+	defer l.Shutdown(context.Background())
+
+	tlsOpts = tlsOptions{ca: ca.file, cert: clientCert, key: clientKey, serverName: "hollomand"}
+	client, err := NewHollomanClient(l.(*grpcListener).lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.GetCapabilities("", 0); err != nil {
+		t.Fatalf("gRPC over mutual TLS: %v", err)
+	}
+}
@@ -1,8 +1,6 @@
 package main
 
 import (
-    "compress/gzip"
-    "encoding/binary"
     "flag"
     "fmt"
     "io"
@@ -14,11 +12,18 @@ import (
 )
 
 type HilbertCurve struct {
-    order uint32
-    x     []uint32
-    y     []uint32
+    order     uint32
+    x         []uint32
+    y         []uint32
+    algorithm string // from the file header, empty for legacy files
 }
 
+// algorithms the tool can generate
+const (
+    algGray    = "gray"    // de-interleaved gray code, what the tool has always generated
+    algHilbert = "hilbert" // hilbert curve with the rotate/flip step
+)
+
 const (
     batchSize  = 1024 * 1024
     bufferSize = 1024 * 1024
@@ -30,44 +35,76 @@ type Worker struct {
     wg         *sync.WaitGroup
 }
 
-func (w *Worker) generatePoints(order uint32) {
+func (w *Worker) generatePoints(order uint32, algorithm string) {
     defer w.wg.Done()
     
     for i := w.start; i < w.end; i++ {
-        gray := i ^ (i >> 1)
-        var x, y uint32
-
-        if order <= 16 {
-            mask := uint32(1)
-            for j := uint32(0); j < order; j++ {
-                bit := (gray >> (2 * j)) & 3
-                if (bit >> 1) & 1 != 0 {
-                    x |= mask
-                }
-                if bit & 1 != 0 {
-                    y |= mask
-                }
-                mask <<= 1
-            }
+        if algorithm == algHilbert {
+            w.x[i], w.y[i] = hilbertPoint(order, i)
         } else {
-            for j := uint32(0); j < order; j++ {
-                bit := (gray >> (2 * j)) & 3
-                x |= ((bit >> 1) & 1) << j
-                y |= (bit & 1) << j
+            w.x[i], w.y[i] = grayPoint(order, i)
+        }
+    }
+}
+
+// grayPoint de-interleaves the gray code of i into x and y. Consecutive
+// indexes are not always adjacent, it is not a hilbert curve.
+func grayPoint(order uint32, i uint32) (x, y uint32) {
+    gray := i ^ (i >> 1)
+
+    if order <= 16 {
+        mask := uint32(1)
+        for j := uint32(0); j < order; j++ {
+            bit := (gray >> (2 * j)) & 3
+            if (bit >> 1) & 1 != 0 {
+                x |= mask
             }
+            if bit & 1 != 0 {
+                y |= mask
+            }
+            mask <<= 1
+        }
+    } else {
+        for j := uint32(0); j < order; j++ {
+            bit := (gray >> (2 * j)) & 3
+            x |= ((bit >> 1) & 1) << j
+            y |= (bit & 1) << j
         }
+    }
+    return x, y
+}
 
-        w.x[i] = x
-        w.y[i] = y
+// hilbertPoint converts the distance i along a hilbert curve into x and y,
+// rotating and flipping each quadrant so consecutive indexes are adjacent.
+// An even number of levels keeps the first 4^k points of every order in the
+// same place, as hollomand computes them.
+func hilbertPoint(order uint32, i uint32) (x, y uint32) {
+    t := i
+    for level := uint32(0); level < (order+1)&^1; level++ {
+        s := uint32(1) << level
+        rx := 1 & (t >> 1)
+        ry := 1 & (t ^ rx)
+        if ry == 0 {
+            if rx == 1 {
+                x = s - 1 - x
+                y = s - 1 - y
+            }
+            x, y = y, x
+        }
+        x += s * rx
+        y += s * ry
+        t >>= 2
     }
+    return x, y
 }
 
-func generateHilbertCurve(order uint32) *HilbertCurve {
-    size := uint32(1 << (2 * order))
+func generateHilbertCurve(order uint32, algorithm string) *HilbertCurve {
+    size := curvePoints(order)
     curve := &HilbertCurve{
-        order: order,
-        x:     make([]uint32, size),
-        y:     make([]uint32, size),
+        order:     order,
+        x:         make([]uint32, size),
+        y:         make([]uint32, size),
+        algorithm: algorithm,
     }
 
     numWorkers := runtime.NumCPU()
@@ -91,7 +128,7 @@ func generateHilbertCurve(order uint32) *HilbertCurve {
             wg:    &wg,
         }
         wg.Add(1)
-        go workers[i].generatePoints(order)
+        go workers[i].generatePoints(order, algorithm)
     }
 
     wg.Wait()
@@ -144,115 +181,6 @@ func min(a, b int) int {
     return b
 }
 
-func (curve *HilbertCurve) saveHilbertCurve(filename string, compress bool) error {
-    file, err := os.Create(filename)
-    if err != nil {
-        return fmt.Errorf("error opening file for writing: %v", err)
-    }
-    defer file.Close()
-
-    var w io.Writer = file
-    if compress {
-        gw := gzip.NewWriter(file)
-        defer gw.Close()
-        w = gw
-    }
-
-    writer := newBufferedWriter(w, bufferSize)
-    defer writer.Flush()
-
-    header := make([]byte, 4)
-    binary.LittleEndian.PutUint32(header, curve.order)
-    if _, err := writer.Write(header); err != nil {
-        return fmt.Errorf("error writing order: %v", err)
-    }
-
-    size := uint32(1 << (2 * curve.order))
-    buf := make([]byte, batchSize*4)
-
-    for i := uint32(0); i < size; i += batchSize {
-        end := min(int(i+batchSize), int(size))
-        pos := 0
-        for j := i; j < uint32(end); j++ {
-            binary.LittleEndian.PutUint32(buf[pos:], curve.x[j])
-            pos += 4
-        }
-        if _, err := writer.Write(buf[:pos]); err != nil {
-            return fmt.Errorf("error writing x coordinates: %v", err)
-        }
-    }
-
-    for i := uint32(0); i < size; i += batchSize {
-        end := min(int(i+batchSize), int(size))
-        pos := 0
-        for j := i; j < uint32(end); j++ {
-            binary.LittleEndian.PutUint32(buf[pos:], curve.y[j])
-            pos += 4
-        }
-        if _, err := writer.Write(buf[:pos]); err != nil {
-            return fmt.Errorf("error writing y coordinates: %v", err)
-        }
-    }
-
-    return nil
-}
-
-func loadHilbertCurve(filename string) (*HilbertCurve, error) {
-    file, err := os.Open(filename)
-    if err != nil {
-        return nil, fmt.Errorf("error opening file for reading: %v", err)
-    }
-    defer file.Close()
-
-    var r io.Reader = file
-    if isGzipped(filename) {
-        gr, err := gzip.NewReader(file)
-        if err != nil {
-            return nil, fmt.Errorf("error creating gzip reader: %v", err)
-        }
-        defer gr.Close()
-        r = gr
-    }
-
-    curve := &HilbertCurve{}
-
-    var orderBuf [4]byte
-    if _, err := io.ReadFull(r, orderBuf[:]); err != nil {
-        return nil, fmt.Errorf("error reading order: %v", err)
-    }
-    curve.order = binary.LittleEndian.Uint32(orderBuf[:])
-
-    size := uint32(1 << (2 * curve.order))
-    curve.x = make([]uint32, size)
-    curve.y = make([]uint32, size)
-
-    buf := make([]byte, batchSize*4)
-
-    for i := uint32(0); i < size; i += batchSize {
-        end := min(int(i+batchSize), int(size))
-        readSize := (end - int(i)) * 4
-        if _, err := io.ReadFull(r, buf[:readSize]); err != nil {
-            return nil, fmt.Errorf("error reading x coordinates: %v", err)
-        }
-        for j := 0; j < readSize/4; j++ {
-            curve.x[i+uint32(j)] = binary.LittleEndian.Uint32(buf[j*4:])
-        }
-    }
-
-    for i := uint32(0); i < size; i += batchSize {
-        end := min(int(i+batchSize), int(size))
-        readSize := (end - int(i)) * 4
-        if _, err := io.ReadFull(r, buf[:readSize]); err != nil {
-            return nil, fmt.Errorf("error reading y coordinates: %v", err)
-        }
-        for j := 0; j < readSize/4; j++ {
-            curve.y[i+uint32(j)] = binary.LittleEndian.Uint32(buf[j*4:])
-        }
-    }
-
-    return curve, nil
-}
-
 func isGzipped(filename string) bool {
     if strings.HasSuffix(strings.ToLower(filename), ".gz") {
         return true
@@ -291,11 +219,34 @@ func main() {
     filename := flag.String("file", "hilbert_curve.dat", "Output/input file name")
     compress := flag.Bool("compress", false, "Use gzip compression")
     verbose := flag.Bool("verbose", false, "Print timing and size information")
-    mode := flag.String("mode", "both", "Operation mode: generate, load, or both")
+    mode := flag.String("mode", "both", "Operation mode: generate, load, both or verify")
+    algorithm := flag.String("algorithm", algGray, "Curve to generate: gray (compatible with existing identifiers) or hilbert")
+    legacy := flag.Bool("legacy", false, "Write the unversioned file layout read by older hollomand")
+    mapped := flag.Bool("mapped", false, "Write an uncompressed page aligned file hollomand can mmap (-curve-mode mmap)")
     flag.Parse()
 
-    if *order > 16 {
-        fmt.Println("Warning: orders > 16 may be slow and memory intensive")
+    if *algorithm != algGray && *algorithm != algHilbert {
+        fmt.Printf("Invalid algorithm: %s\n", *algorithm)
+        os.Exit(1)
+    }
+
+    if *order == 0 || *order > maxOrder {
+        fmt.Printf("Invalid order: %d, the curve files hold orders 1-%d\n", *order, maxOrder)
+        os.Exit(1)
+    }
+
+    layout := layoutV2
+    switch {
+    case *legacy && *mapped:
+        fmt.Println("-legacy and -mapped are exclusive")
+        os.Exit(1)
+    case *mapped && *compress:
+        fmt.Println("mapped curve files can not be compressed")
+        os.Exit(1)
+    case *legacy:
+        layout = layoutLegacy
+    case *mapped:
+        layout = layoutMapped
     }
 
     outputFile := *filename
@@ -309,13 +260,13 @@ func main() {
     switch strings.ToLower(*mode) {
     case "generate", "both":
         genStart := time.Now()
-        curve = generateHilbertCurve(uint32(*order))
+        curve = generateHilbertCurve(uint32(*order), *algorithm)
         if *verbose {
             fmt.Printf("Generation time: %v\n", time.Since(genStart))
         }
 
         saveStart := time.Now()
-        err := curve.saveHilbertCurve(outputFile, *compress)
+        err := curve.saveHilbertCurve(outputFile, *compress, layout)
         if err != nil {
             fmt.Printf("Error saving curve: %v\n", err)
             os.Exit(1)
@@ -327,9 +278,12 @@ func main() {
             fmt.Printf("Save time: %v\n", saveTime)
             fmt.Printf("File size: %s\n", formatSize(fileInfo.Size()))
             if *compress {
-                // Calculate total bytes without compression (8 bytes per point)
+                // Calculate total bytes without compression (4 or 8 bytes per point)
                 totalPoints := uint64(1) << (2 * (*order))
-                uncompressedSize := float64(totalPoints * 8)
+                uncompressedSize := float64(totalPoints * 4)
+                if *legacy {
+                    uncompressedSize *= 2
+                }
                 compressionRatio := float64(fileInfo.Size()) / uncompressedSize
                 fmt.Printf("Compression ratio: %.2f%%\n", compressionRatio*100)
             }
@@ -352,6 +306,19 @@ func main() {
         }
         curve = loadedCurve
 
+    case "verify":
+        loadedCurve, err := loadHilbertCurve(*filename)
+        if err != nil {
+            fmt.Printf("Error loading curve: %v\n", err)
+            os.Exit(1)
+        }
+        report := verifyHilbertCurve(loadedCurve)
+        report.print()
+        if len(report.violations()) > 0 {
+            os.Exit(2)
+        }
+        curve = loadedCurve
+
     default:
         fmt.Printf("Invalid mode: %s\n", *mode)
         os.Exit(1)
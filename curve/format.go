@@ -0,0 +1,288 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "compress/gzip"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "hash"
+    "hash/crc32"
+    "io"
+    "os"
+)
+
+// Version 2 curve files start with a 32 byte little-endian header, the same
+// layout hollomand reads:
+//
+//	0  magic "HHCURVE\x00"
+//	8  uint16 format version
+//	10 uint8  algorithm, 1 gray 2 hilbert
+//	11 uint8  coordinate width in bytes, 2 or 4
+//	12 uint32 order
+//	16 uint32 CRC-32C of the coordinates as stored
+//	20 uint32 flags
+//	24 reserved
+//
+// followed by the X then the Y coordinates. Mapped files are uncompressed
+// and page aligned: X starts at pageLen and Y at the next page boundary
+// after X. Legacy files are a uint32 order followed by uint32 X then Y
+// coordinates.
+const (
+    fileMagic     = "HHCURVE\x00"
+    formatVersion = 2
+    headerLen     = 32
+    maxOrder      = 15 // 4^16 points do not fit the uint32 indexes
+    pageLen       = 4096
+
+    flagPageAligned = 1 << 0
+
+    // file layouts the tool writes
+    layoutV2     = "v2"
+    layoutMapped = "mapped"
+    layoutLegacy = "legacy"
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+func algorithmTag(algorithm string) byte {
+    switch algorithm {
+    case algGray:
+        return 1
+    case algHilbert:
+        return 2
+    }
+    return 0
+}
+
+func algorithmName(tag byte) string {
+    switch tag {
+    case 1:
+        return algGray
+    case 2:
+        return algHilbert
+    }
+    return "unknown"
+}
+
+// padding returns the zero bytes before X and between X and Y in a page
+// aligned file, Y is followed by the same padding as between X and Y
+func padding(size uint32, width int) (xPad, yPad int) {
+    n := int(size) * width
+    return pageLen - headerLen, (n+pageLen-1)/pageLen*pageLen - n
+}
+
+func (curve *HilbertCurve) saveHilbertCurve(filename string, compress bool, layout string) error {
+    file, err := os.Create(filename)
+    if err != nil {
+        return fmt.Errorf("error opening file for writing: %v", err)
+    }
+    defer file.Close()
+
+    var w io.Writer = file
+    if compress {
+        gw := gzip.NewWriter(file)
+        defer gw.Close()
+        w = gw
+    }
+
+    writer := newBufferedWriter(w, bufferSize)
+    defer writer.Flush()
+
+    if curve.order == 0 || curve.order > maxOrder {
+        return fmt.Errorf("order %d, the curve files hold orders 1-%d", curve.order, maxOrder)
+    }
+    size := curvePoints(curve.order)
+    width := 2
+    var xPad, yPad int
+    if layout == layoutLegacy {
+        width = 4
+        header := make([]byte, 4)
+        binary.LittleEndian.PutUint32(header, curve.order)
+        if _, err := writer.Write(header); err != nil {
+            return fmt.Errorf("error writing order: %v", err)
+        }
+    } else {
+        // the checksum leads the coordinates, encode them twice
+        crc := crc32.New(crcTable)
+        writeCoordinates(crc, curve.x[:size], width)
+        writeCoordinates(crc, curve.y[:size], width)
+
+        header := make([]byte, headerLen)
+        copy(header, fileMagic)
+        binary.LittleEndian.PutUint16(header[8:], formatVersion)
+        header[10] = algorithmTag(curve.algorithm)
+        header[11] = byte(width)
+        binary.LittleEndian.PutUint32(header[12:], curve.order)
+        binary.LittleEndian.PutUint32(header[16:], crc.Sum32())
+        if layout == layoutMapped {
+            binary.LittleEndian.PutUint32(header[20:], flagPageAligned)
+            xPad, yPad = padding(size, width)
+        }
+        if _, err := writer.Write(header); err != nil {
+            return fmt.Errorf("error writing header: %v", err)
+        }
+    }
+
+    if _, err := writer.Write(make([]byte, xPad)); err != nil {
+        return fmt.Errorf("error writing header: %v", err)
+    }
+    if err := writeCoordinates(writer, curve.x[:size], width); err != nil {
+        return fmt.Errorf("error writing x coordinates: %v", err)
+    }
+    if _, err := writer.Write(make([]byte, yPad)); err != nil {
+        return fmt.Errorf("error writing x coordinates: %v", err)
+    }
+    if err := writeCoordinates(writer, curve.y[:size], width); err != nil {
+        return fmt.Errorf("error writing y coordinates: %v", err)
+    }
+    if _, err := writer.Write(make([]byte, yPad)); err != nil {
+        return fmt.Errorf("error writing y coordinates: %v", err)
+    }
+    return nil
+}
+
+func writeCoordinates(w io.Writer, coords []uint32, width int) error {
+    buf := make([]byte, batchSize*width)
+
+    for i := 0; i < len(coords); i += batchSize {
+        end := min(i+batchSize, len(coords))
+        pos := 0
+        for _, c := range coords[i:end] {
+            if width == 2 {
+                binary.LittleEndian.PutUint16(buf[pos:], uint16(c))
+            } else {
+                binary.LittleEndian.PutUint32(buf[pos:], c)
+            }
+            pos += width
+        }
+        if _, err := w.Write(buf[:pos]); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// loadHilbertCurve reads version 2 and legacy curve files
+func loadHilbertCurve(filename string) (*HilbertCurve, error) {
+    file, err := os.Open(filename)
+    if err != nil {
+        return nil, fmt.Errorf("error opening file for reading: %v", err)
+    }
+    defer file.Close()
+
+    var r io.Reader = file
+    if isGzipped(filename) {
+        gr, err := gzip.NewReader(file)
+        if err != nil {
+            return nil, fmt.Errorf("error creating gzip reader: %v", err)
+        }
+        defer gr.Close()
+        r = gr
+    }
+    br := bufio.NewReaderSize(r, bufferSize)
+
+    head := make([]byte, headerLen)
+    if _, err := io.ReadFull(br, head[:8]); err != nil {
+        return nil, truncated("header", err)
+    }
+
+    curve := &HilbertCurve{}
+    width := 4
+    var crc hash.Hash32
+    var checksum uint32
+    var flags uint32
+    if bytes.Equal(head[:8], []byte(fileMagic)) {
+        if _, err := io.ReadFull(br, head[8:]); err != nil {
+            return nil, truncated("header", err)
+        }
+        if version := binary.LittleEndian.Uint16(head[8:]); version != formatVersion {
+            return nil, fmt.Errorf("unsupported curve format version %d", version)
+        }
+        curve.algorithm = algorithmName(head[10])
+        width = int(head[11])
+        if width != 2 && width != 4 {
+            return nil, fmt.Errorf("corrupt curve header: coordinate width %d", width)
+        }
+        curve.order = binary.LittleEndian.Uint32(head[12:])
+        crc = crc32.New(crcTable)
+        checksum = binary.LittleEndian.Uint32(head[16:])
+        flags = binary.LittleEndian.Uint32(head[20:])
+        if flags&^flagPageAligned != 0 {
+            return nil, fmt.Errorf("unsupported curve header flags %#x", flags)
+        }
+        r = io.TeeReader(br, crc)
+    } else {
+        curve.order = binary.LittleEndian.Uint32(head[:4])
+        r = io.MultiReader(bytes.NewReader(head[4:8]), br)
+    }
+    if curve.order == 0 || curve.order > maxOrder {
+        return nil, fmt.Errorf("not a curve file or corrupt: order %d", curve.order)
+    }
+
+    size := curvePoints(curve.order)
+    var xPad, yPad int
+    if flags&flagPageAligned != 0 {
+        xPad, yPad = padding(size, width)
+    }
+    // the padding is not checksummed
+    if _, err := io.CopyN(io.Discard, br, int64(xPad)); err != nil {
+        return nil, truncated("header", err)
+    }
+    if curve.x, err = readCoordinates(r, size, width); err != nil {
+        return nil, truncated("x coordinates", err)
+    }
+    if _, err := io.CopyN(io.Discard, br, int64(yPad)); err != nil {
+        return nil, truncated("y coordinates", err)
+    }
+    if curve.y, err = readCoordinates(r, size, width); err != nil {
+        return nil, truncated("y coordinates", err)
+    }
+    if _, err := io.CopyN(io.Discard, br, int64(yPad)); err != nil {
+        return nil, truncated("y coordinates", err)
+    }
+    if _, err := br.ReadByte(); err != io.EOF {
+        if err != nil {
+            return nil, fmt.Errorf("error reading y coordinates: %v", err)
+        }
+        return nil, fmt.Errorf("curve file is longer than the %d points of order %d", size, curve.order)
+    }
+    if crc != nil && crc.Sum32() != checksum {
+        return nil, fmt.Errorf("curve file is corrupt: checksum %08x, header says %08x", crc.Sum32(), checksum)
+    }
+    return curve, nil
+}
+
+// curvePoints returns the number of points of a curve of order, 4^order
+func curvePoints(order uint32) uint32 {
+    return uint32(1) << (2 * order)
+}
+
+func readCoordinates(r io.Reader, size uint32, width int) ([]uint32, error) {
+    coords := make([]uint32, size)
+    buf := make([]byte, batchSize*width)
+
+    for i := uint32(0); i < size; i += batchSize {
+        end := min(int(i+batchSize), int(size))
+        readSize := (end - int(i)) * width
+        if _, err := io.ReadFull(r, buf[:readSize]); err != nil {
+            return nil, err
+        }
+        for j := 0; j < readSize/width; j++ {
+            if width == 2 {
+                coords[i+uint32(j)] = uint32(binary.LittleEndian.Uint16(buf[j*2:]))
+            } else {
+                coords[i+uint32(j)] = binary.LittleEndian.Uint32(buf[j*4:])
+            }
+        }
+    }
+    return coords, nil
+}
+
+func truncated(what string, err error) error {
+    if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+        return fmt.Errorf("curve file is truncated reading %s", what)
+    }
+    return fmt.Errorf("error reading %s: %v", what, err)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+)
+
+// verifyReport describes a curve file checked by verifyHilbertCurve
+type verifyReport struct {
+    order      uint32
+    points     uint64
+    outside    uint64 // points outside the 2^order square
+    duplicates uint64 // cells visited more than once
+    jumps      uint64 // consecutive points that are not adjacent
+    firstJump  int64  // index of the first jump, -1 when there is none
+    algorithm  string // generator that reproduces every point, unknown when none does
+    header     string // algorithm in the file header, gray for legacy files
+}
+
+func (r *verifyReport) bijective() bool {
+    return r.outside == 0 && r.duplicates == 0
+}
+
+func (r *verifyReport) continuous() bool {
+    return r.jumps == 0
+}
+
+// violations lists what is wrong with the curve file. The gray mapping
+// jumps by design so its steps are checked by reproducing every point, a
+// hilbert curve must step to an adjacent cell every time.
+func (r *verifyReport) violations() []string {
+    var v []string
+    if !r.bijective() {
+        v = append(v, "not bijective")
+    }
+    if r.algorithm != r.header {
+        v = append(v, fmt.Sprintf("the header says %s, the points are %s", r.header, r.algorithm))
+    }
+    if !r.continuous() && r.header != algGray {
+        v = append(v, fmt.Sprintf("%d steps are not adjacent", r.jumps))
+    }
+    return v
+}
+
+// verifyHilbertCurve checks the curve visits every cell of the square once,
+// that each step moves to an adjacent cell and which algorithm generated it
+func verifyHilbertCurve(curve *HilbertCurve) *verifyReport {
+    side := uint64(1) << curve.order
+    size := uint64(1) << (2 * curve.order)
+    r := &verifyReport{order: curve.order, points: size, firstJump: -1, header: curve.algorithm}
+    if r.header == "" {
+        r.header = algGray
+    }
+
+    visited := make([]uint64, (size+63)/64)
+    gray, hilbert := true, true
+
+    for i := uint64(0); i < size; i++ {
+        x, y := curve.x[i], curve.y[i]
+
+        if uint64(x) >= side || uint64(y) >= side {
+            r.outside++
+        } else {
+            cell := uint64(y)*side + uint64(x)
+            if visited[cell/64] & (1 << (cell % 64)) != 0 {
+                r.duplicates++
+            }
+            visited[cell/64] |= 1 << (cell % 64)
+        }
+
+        if i > 0 {
+            dx := int64(x) - int64(curve.x[i-1])
+            dy := int64(y) - int64(curve.y[i-1])
+            if dx*dx + dy*dy != 1 {
+                if r.jumps == 0 {
+                    r.firstJump = int64(i)
+                }
+                r.jumps++
+            }
+        }
+
+        if gray {
+            gx, gy := grayPoint(curve.order, uint32(i))
+            gray = gx == x && gy == y
+        }
+        if hilbert {
+            hx, hy := hilbertPoint(curve.order, uint32(i))
+            hilbert = hx == x && hy == y
+        }
+    }
+
+    r.algorithm = "unknown"
+    if gray {
+        r.algorithm = algGray
+    } else if hilbert {
+        r.algorithm = algHilbert
+    }
+    return r
+}
+
+func (r *verifyReport) print() {
+    fmt.Printf("Order: %d (%d points)\n", r.order, r.points)
+    fmt.Printf("Algorithm: %s (header %s)\n", r.algorithm, r.header)
+    if r.bijective() {
+        fmt.Printf("Bijective: yes\n")
+    } else {
+        fmt.Printf("Bijective: no, %d points outside the square, %d cells visited twice\n", r.outside, r.duplicates)
+    }
+    if r.continuous() {
+        fmt.Printf("Adjacent steps: yes\n")
+    } else {
+        fmt.Printf("Adjacent steps: no, %d jumps, the first at index %d\n", r.jumps, r.firstJump)
+    }
+    if v := r.violations(); len(v) > 0 {
+        fmt.Printf("Verified: no, %s\n", strings.Join(v, ", "))
+    } else {
+        fmt.Printf("Verified: yes\n")
+    }
+}
@@ -0,0 +1,397 @@
+package HuntingHash
+
+//
+// Copyright 2025 (c) By Rick Wesson & Support Intelligence, Inc.
+// Licenced under the RLL 1.0
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// Curve files are optionally gzip compressed. The legacy layout is a
+// little-endian uint32 order followed by the X then the Y coordinates as
+// uint32. Version 2 starts with a 32 byte little-endian header:
+//
+//	0  magic "HHCURVE\x00"
+//	8  uint16 format version
+//	10 uint8  curve algorithm
+//	11 uint8  coordinate width in bytes, 2 or 4
+//	12 uint32 order
+//	16 uint32 CRC-32C of the coordinates as stored
+//	20 uint32 flags
+//	24 reserved
+//
+// followed by the X then the Y coordinates. Page aligned files are not
+// compressed, the X coordinates start at CURVE_PAGE_LEN and the Y
+// coordinates at the next page boundary after them so both can be mapped.
+//
+// Orders go up to CURVE_MAX_ORDER, the 4^order points of a curve are counted
+// in uint32 and 4^16 does not fit.
+const (
+	CURVE_MAGIC          = "HHCURVE\x00"
+	CURVE_FORMAT_VERSION = 2
+	CURVE_HEADER_LEN     = 32
+	CURVE_MAX_ORDER      = 15
+	curveBatch           = 1 << 20 // coordinates encoded or decoded at a time
+
+	CURVE_FLAG_PAGE_ALIGNED = 1 << 0
+	CURVE_FLAGS_KNOWN       = CURVE_FLAG_PAGE_ALIGNED
+	CURVE_PAGE_LEN          = 4096
+)
+
+type curveHeader struct {
+	Version   uint16
+	Algorithm CurveAlgorithm
+	Width     uint8
+	Order     uint32
+	Checksum  uint32
+	Flags     uint32
+}
+
+func (hdr *curveHeader) marshal() []byte {
+	b := make([]byte, CURVE_HEADER_LEN)
+	copy(b, CURVE_MAGIC)
+	binary.LittleEndian.PutUint16(b[8:], hdr.Version)
+	b[10] = byte(hdr.Algorithm)
+	b[11] = hdr.Width
+	binary.LittleEndian.PutUint32(b[12:], hdr.Order)
+	binary.LittleEndian.PutUint32(b[16:], hdr.Checksum)
+	binary.LittleEndian.PutUint32(b[20:], hdr.Flags)
+	return b
+}
+
+func (hdr *curveHeader) unmarshal(b []byte) error {
+	hdr.Version = binary.LittleEndian.Uint16(b[8:])
+	hdr.Algorithm = CurveAlgorithm(b[10])
+	hdr.Width = b[11]
+	hdr.Order = binary.LittleEndian.Uint32(b[12:])
+	hdr.Checksum = binary.LittleEndian.Uint32(b[16:])
+	hdr.Flags = binary.LittleEndian.Uint32(b[20:])
+
+	if hdr.Version != CURVE_FORMAT_VERSION {
+		return fmt.Errorf("unsupported curve format version %d", hdr.Version)
+	}
+	if hdr.Width != 2 && hdr.Width != 4 {
+		return fmt.Errorf("corrupt curve header: coordinate width %d", hdr.Width)
+	}
+	if hdr.Order == 0 || hdr.Order > CURVE_MAX_ORDER {
+		return fmt.Errorf("corrupt curve header: order %d", hdr.Order)
+	}
+	if hdr.Flags&^CURVE_FLAGS_KNOWN != 0 {
+		return fmt.Errorf("unsupported curve header flags %#x", hdr.Flags)
+	}
+	return nil
+}
+
+// points is the number of coordinate pairs in the file, the header is valid
+func (hdr *curveHeader) points() uint32 {
+	return curvePoints(hdr.Order)
+}
+
+// curvePoints is the number of points of a curve of order, at most
+// CURVE_MAX_ORDER
+func curvePoints(order uint32) uint32 {
+	return uint32(1) << (2 * order)
+}
+
+// layout returns the offsets of the X and Y coordinates from the start of a
+// page aligned file and its length
+func (hdr *curveHeader) layout() (xOff, yOff, length int64) {
+	n := pageAlign(int64(hdr.points()) * int64(hdr.Width))
+	return CURVE_PAGE_LEN, CURVE_PAGE_LEN + n, CURVE_PAGE_LEN + 2*n
+}
+
+func pageAlign(n int64) int64 {
+	return (n + CURVE_PAGE_LEN - 1) &^ (CURVE_PAGE_LEN - 1)
+}
+
+// LoadHilbertCurve reads a Hilbert curve from a file and returns it, both
+// the legacy and the versioned layout are accepted, compressed or not.
+func LoadHilbertCurve(filename string) (*HilbertCurve, error) {
+	// Open the file for reading
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %w", err)
+	}
+	defer file.Close()
+
+	return ReadHilbertCurve(file)
+}
+
+// ReadHilbertCurve reads a curve file from r
+func ReadHilbertCurve(r io.Reader) (*HilbertCurve, error) {
+	br := bufio.NewReaderSize(r, 1<<20)
+
+	// gzip streams start with 1f 8b
+	if sig, err := br.Peek(2); err == nil && sig[0] == 0x1f && sig[1] == 0x8b {
+		gzReader, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("error creating gzip reader: %w", err)
+		}
+		defer gzReader.Close()
+		br = bufio.NewReaderSize(gzReader, 1<<20)
+	}
+
+	head := make([]byte, len(CURVE_MAGIC))
+	if _, err := io.ReadFull(br, head); err != nil {
+		return nil, truncated("header", err)
+	}
+
+	if !bytes.Equal(head, []byte(CURVE_MAGIC)) {
+		return readLegacyCurve(head, br)
+	}
+
+	b := make([]byte, CURVE_HEADER_LEN)
+	copy(b, head)
+	if _, err := io.ReadFull(br, b[len(head):]); err != nil {
+		return nil, truncated("header", err)
+	}
+	var hdr curveHeader
+	if err := hdr.unmarshal(b); err != nil {
+		return nil, err
+	}
+
+	curve := &HilbertCurve{Order: hdr.Order, Algorithm: hdr.Algorithm}
+	size := hdr.points()
+	crc := crc32.New(crcTable)
+	tee := io.TeeReader(br, crc)
+
+	// skip the padding of page aligned files, it is not checksummed
+	var xPad, yPad int64
+	if hdr.Flags&CURVE_FLAG_PAGE_ALIGNED != 0 {
+		xOff, yOff, _ := hdr.layout()
+		xPad = xOff - CURVE_HEADER_LEN
+		yPad = yOff - xOff - int64(size)*int64(hdr.Width)
+	}
+
+	var err error
+	if _, err = io.CopyN(io.Discard, br, xPad); err != nil {
+		return nil, truncated("header", err)
+	}
+	if curve.X, err = readCoordinates(tee, size, int(hdr.Width)); err != nil {
+		return nil, truncated("X coordinates", err)
+	}
+	if _, err = io.CopyN(io.Discard, br, yPad); err != nil {
+		return nil, truncated("Y coordinates", err)
+	}
+	if curve.Y, err = readCoordinates(tee, size, int(hdr.Width)); err != nil {
+		return nil, truncated("Y coordinates", err)
+	}
+	if _, err = io.CopyN(io.Discard, br, yPad); err != nil {
+		return nil, truncated("Y coordinates", err)
+	}
+	if err := atEOF(br, hdr.Order); err != nil {
+		return nil, err
+	}
+	if crc.Sum32() != hdr.Checksum {
+		return nil, fmt.Errorf("curve file is corrupt: checksum %08x, header says %08x", crc.Sum32(), hdr.Checksum)
+	}
+	return curve, nil
+}
+
+// readLegacyCurve reads the unversioned layout, head holds its first bytes
+func readLegacyCurve(head []byte, r io.Reader) (*HilbertCurve, error) {
+	// Legacy files carry no algorithm, the curve tool only ever wrote the
+	// gray code mapping
+	curve := &HilbertCurve{Algorithm: CURVE_GRAY}
+
+	// Read the order
+	curve.Order = binary.LittleEndian.Uint32(head)
+	if curve.Order == 0 || curve.Order > CURVE_MAX_ORDER {
+		return nil, fmt.Errorf("not a curve file or corrupt: order %d", curve.Order)
+	}
+
+	// Calculate size based on order
+	size := curvePoints(curve.Order)
+	r = io.MultiReader(bytes.NewReader(head[4:]), r)
+
+	var err error
+	if curve.X, err = readCoordinates(r, size, 4); err != nil {
+		return nil, truncated("X coordinates", err)
+	}
+	if curve.Y, err = readCoordinates(r, size, 4); err != nil {
+		return nil, truncated("Y coordinates", err)
+	}
+	if err := atEOF(r, curve.Order); err != nil {
+		return nil, err
+	}
+	return curve, nil
+}
+
+// atEOF checks that the coordinates of order end the file, a file holding
+// more does not match its header
+func atEOF(r io.Reader, order uint32) error {
+	var b [1]byte
+	n, err := io.ReadFull(r, b[:])
+	if n == 0 && errors.Is(err, io.EOF) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading curve file: %w", err)
+	}
+	return fmt.Errorf("curve file is longer than the %d points of order %d", curvePoints(order), order)
+}
+
+func truncated(what string, err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("curve file is truncated reading %s", what)
+	}
+	return fmt.Errorf("error reading %s: %w", what, err)
+}
+
+func readCoordinates(r io.Reader, size uint32, width int) ([]uint32, error) {
+	coords := make([]uint32, size)
+	buf := make([]byte, curveBatch*width)
+
+	for i := uint32(0); i < size; i += curveBatch {
+		n := min(curveBatch, size-i)
+		b := buf[:int(n)*width]
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		for j := uint32(0); j < n; j++ {
+			if width == 2 {
+				coords[i+j] = uint32(binary.LittleEndian.Uint16(b[j*2:]))
+			} else {
+				coords[i+j] = binary.LittleEndian.Uint32(b[j*4:])
+			}
+		}
+	}
+	return coords, nil
+}
+
+// Save writes the curve to filename in the versioned layout
+func (curve *HilbertCurve) Save(filename string, compress bool) error {
+	return curve.save(filename, compress, 0)
+}
+
+func (curve *HilbertCurve) save(filename string, compress bool, flags uint32) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("error opening file for writing: %w", err)
+	}
+
+	var w io.Writer = file
+	var gw *gzip.Writer
+	if compress {
+		gw = gzip.NewWriter(file)
+		w = gw
+	}
+	bw := bufio.NewWriterSize(w, 1<<20)
+
+	err = curve.write(bw, flags)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil && gw != nil {
+		err = gw.Close()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Write writes the versioned layout of the curve to w, the points a
+// computed curve does not tabulate are computed as they are written
+func (curve *HilbertCurve) Write(w io.Writer) error {
+	return curve.write(w, 0)
+}
+
+func (curve *HilbertCurve) write(w io.Writer, flags uint32) error {
+	if curve.Order == 0 || curve.Order > CURVE_MAX_ORDER {
+		return fmt.Errorf("curve order %d is out of range 1-%d", curve.Order, CURVE_MAX_ORDER)
+	}
+	size := curvePoints(curve.Order)
+	tabulated := uint32(len(curve.x16)) >= size || uint32(min(len(curve.X), len(curve.Y))) >= size
+	computed := curve.mapped == nil && (curve.Algorithm == CURVE_GRAY || curve.Algorithm == CURVE_HILBERT)
+	if !tabulated && !computed {
+		return fmt.Errorf("the curve does not hold the %d points of order %d", size, curve.Order)
+	}
+	x := func(i uint32) uint32 { x, _ := curve.Point(i); return x }
+	y := func(i uint32) uint32 { _, y := curve.Point(i); return y }
+
+	hdr := curveHeader{
+		Version:   CURVE_FORMAT_VERSION,
+		Algorithm: curve.Algorithm,
+		Width:     2, // coordinates of every order up to CURVE_MAX_ORDER fit
+		Order:     curve.Order,
+		Flags:     flags,
+	}
+
+	// the checksum leads the coordinates, encode them twice rather than
+	// holding the file in memory
+	crc := crc32.New(crcTable)
+	writeCoordinates(crc, size, x, int(hdr.Width))
+	writeCoordinates(crc, size, y, int(hdr.Width))
+	hdr.Checksum = crc.Sum32()
+
+	var xPad, yPad int64
+	if flags&CURVE_FLAG_PAGE_ALIGNED != 0 {
+		xOff, yOff, _ := hdr.layout()
+		xPad = xOff - CURVE_HEADER_LEN
+		yPad = yOff - xOff - int64(size)*int64(hdr.Width)
+	}
+
+	if _, err := w.Write(hdr.marshal()); err != nil {
+		return fmt.Errorf("error writing header: %w", err)
+	}
+	if err := writePadding(w, xPad); err != nil {
+		return fmt.Errorf("error writing header: %w", err)
+	}
+	if err := writeCoordinates(w, size, x, int(hdr.Width)); err != nil {
+		return fmt.Errorf("error writing X coordinates: %w", err)
+	}
+	if err := writePadding(w, yPad); err != nil {
+		return fmt.Errorf("error writing X coordinates: %w", err)
+	}
+	if err := writeCoordinates(w, size, y, int(hdr.Width)); err != nil {
+		return fmt.Errorf("error writing Y coordinates: %w", err)
+	}
+	// the Y coordinates end on a page boundary too
+	if err := writePadding(w, yPad); err != nil {
+		return fmt.Errorf("error writing Y coordinates: %w", err)
+	}
+	return nil
+}
+
+func writePadding(w io.Writer, n int64) error {
+	_, err := io.CopyN(w, zeroReader{}, n)
+	return err
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// writeCoordinates encodes coord of the first size points
+func writeCoordinates(w io.Writer, size uint32, coord func(uint32) uint32, width int) error {
+	buf := make([]byte, curveBatch*width)
+
+	for i := uint32(0); i < size; i += curveBatch {
+		n := min(curveBatch, size-i)
+		b := buf[:int(n)*width]
+		for j := uint32(0); j < n; j++ {
+			if width == 2 {
+				binary.LittleEndian.PutUint16(b[j*2:], uint16(coord(i+j)))
+			} else {
+				binary.LittleEndian.PutUint32(b[j*4:], coord(i+j))
+			}
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package HuntingHash
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// tabulatedCurve returns a curve of order holding every point in X and Y
+func tabulatedCurve(t *testing.T, order uint32, alg CurveAlgorithm) *HilbertCurve {
+	t.Helper()
+
+	computed, err := NewComputedHilbertCurve(order, alg, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := curvePoints(order)
+	curve := &HilbertCurve{Order: order, Algorithm: alg, X: make([]uint32, size), Y: make([]uint32, size)}
+	for i := uint32(0); i < size; i++ {
+		curve.X[i], curve.Y[i] = computed.Point(i)
+	}
+	return curve
+}
+
+func sameCurve(t *testing.T, got, want *HilbertCurve) {
+	t.Helper()
+
+	if got.Order != want.Order || got.Algorithm != want.Algorithm {
+		t.Fatalf("order %d %s, want order %d %s", got.Order, got.Algorithm, want.Order, want.Algorithm)
+	}
+	for i := uint32(0); i < curvePoints(want.Order); i++ {
+		if x, y := got.Point(i); x != want.X[i] || y != want.Y[i] {
+			t.Fatalf("order %d: point %d is (%d,%d), want (%d,%d)", want.Order, i, x, y, want.X[i], want.Y[i])
+		}
+	}
+}
+
+func TestCurveFileRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	for _, alg := range []CurveAlgorithm{CURVE_GRAY, CURVE_HILBERT} {
+		for order := uint32(1); order <= 7; order++ {
+			want := tabulatedCurve(t, order, alg)
+
+			for _, compress := range []bool{false, true} {
+				name := filepath.Join(dir, "curve.dat")
+				if err := want.Save(name, compress); err != nil {
+					t.Fatal(err)
+				}
+				got, err := LoadHilbertCurve(name)
+				if err != nil {
+					t.Fatalf("order %d %s, compressed %v: %v", order, alg, compress, err)
+				}
+				sameCurve(t, got, want)
+			}
+
+			name := filepath.Join(dir, "curve.map")
+			if err := want.SaveMapped(name); err != nil {
+				t.Fatal(err)
+			}
+			got, err := LoadHilbertCurve(name)
+			if err != nil {
+				t.Fatalf("order %d %s, page aligned: %v", order, alg, err)
+			}
+			sameCurve(t, got, want)
+		}
+	}
+}
+
+func TestCurveFileMaxOrder(t *testing.T) {
+	hdr := curveHeader{Version: CURVE_FORMAT_VERSION, Algorithm: CURVE_GRAY, Width: 2, Order: CURVE_MAX_ORDER}
+	if n := hdr.points(); n != 1<<30 {
+		t.Fatalf("order %d has %d points, want %d", CURVE_MAX_ORDER, n, 1<<30)
+	}
+	xOff, yOff, length := hdr.layout()
+	if yOff-xOff != 2<<30 || length != CURVE_PAGE_LEN+4<<30 {
+		t.Fatalf("order %d layout %d %d %d", CURVE_MAX_ORDER, xOff, yOff, length)
+	}
+
+	// an order past the maximum is refused when reading and writing
+	hdr.Order = CURVE_MAX_ORDER + 1
+	if err := new(curveHeader).unmarshal(hdr.marshal()); err == nil {
+		t.Errorf("header of order %d accepted", hdr.Order)
+	}
+	if _, err := ReadHilbertCurve(bytes.NewReader(hdr.marshal())); err == nil {
+		t.Errorf("file of order %d accepted", hdr.Order)
+	}
+	too := &HilbertCurve{Order: CURVE_MAX_ORDER + 1, Algorithm: CURVE_GRAY}
+	if err := too.Write(&bytes.Buffer{}); err == nil {
+		t.Errorf("curve of order %d written", too.Order)
+	}
+
+	// the points are computed as they are written and checked in the
+	// mapped file, loading them would take 8 GiB. Writing the 4 GiB file
+	// takes minutes.
+	if os.Getenv("HH_LARGE_TESTS") == "" {
+		t.Skip("set HH_LARGE_TESTS to round trip a curve of the maximum order")
+	}
+	want, err := NewComputedHilbertCurve(CURVE_MAX_ORDER, CURVE_GRAY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(t.TempDir(), "curve.map")
+	if err := want.SaveMapped(name); err != nil {
+		t.Fatal(err)
+	}
+	st, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Size() != length {
+		t.Fatalf("file of %d bytes, want %d", st.Size(), length)
+	}
+	got, err := MmapHilbertCurve(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer got.Close()
+	if got.Order != CURVE_MAX_ORDER {
+		t.Fatalf("mapped order %d", got.Order)
+	}
+	last := curvePoints(CURVE_MAX_ORDER) - 1
+	for i := uint32(0); ; i += 65521 {
+		i = min(i, last)
+		x, y := got.Point(i)
+		if wx, wy := want.Point(i); x != wx || y != wy {
+			t.Fatalf("point %d is (%d,%d), want (%d,%d)", i, x, y, wx, wy)
+		}
+		if i == last {
+			break
+		}
+	}
+}
+
+func TestCurveFileLengthMismatch(t *testing.T) {
+	var file bytes.Buffer
+	if err := tabulatedCurve(t, 4, CURVE_GRAY).Write(&file); err != nil {
+		t.Fatal(err)
+	}
+	b := file.Bytes()
+
+	if _, err := ReadHilbertCurve(bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadHilbertCurve(bytes.NewReader(b[:len(b)-1])); err == nil {
+		t.Error("truncated curve file accepted")
+	}
+	if _, err := ReadHilbertCurve(bytes.NewReader(append(b[:len(b):len(b)], 0))); err == nil {
+		t.Error("curve file longer than its header accepted")
+	}
+
+	// a legacy table holding more points than its order
+	legacy, err := os.ReadFile(writeCurveTable(t, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadHilbertCurve(bytes.NewReader(legacy)); err != nil {
+		t.Fatal(err)
+	}
+	var long bytes.Buffer
+	long.Write([]byte{3, 0, 0, 0})
+	long.Write(make([]byte, 2*4*curvePoints(3)+4))
+	if _, err := ReadHilbertCurve(&long); err == nil {
+		t.Error("legacy curve file longer than its order accepted")
+	}
+}
@@ -0,0 +1,105 @@
+package HuntingHash
+
+//
+// Copyright 2025 (c) By Rick Wesson & Support Intelligence, Inc.
+// Licenced under the RLL 1.0
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// SaveMapped writes the curve to filename uncompressed and page aligned, the
+// layout MmapHilbertCurve maps
+func (curve *HilbertCurve) SaveMapped(filename string) error {
+	return curve.save(filename, false, CURVE_FLAG_PAGE_ALIGNED)
+}
+
+// MmapHilbertCurve maps a page aligned curve file read only. Processes
+// mapping the same file share its pages, nothing is read until a point is
+// looked up. The checksum is not verified, LoadHilbertCurve does. Close
+// unmaps the file.
+func MmapHilbertCurve(filename string) (*HilbertCurve, error) {
+	if binary.NativeEndian.Uint16([]byte{1, 0}) != 1 {
+		return nil, fmt.Errorf("mapped curve files require a little-endian host")
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %w", err)
+	}
+	defer file.Close()
+
+	b := make([]byte, CURVE_HEADER_LEN)
+	if _, err := file.ReadAt(b, 0); err != nil {
+		return nil, truncated("header", err)
+	}
+	if b[0] == 0x1f && b[1] == 0x8b {
+		return nil, fmt.Errorf("%s is compressed, mapped curve files are not", filename)
+	}
+	if string(b[:len(CURVE_MAGIC)]) != CURVE_MAGIC {
+		return nil, fmt.Errorf("%s is not a versioned curve file", filename)
+	}
+	var hdr curveHeader
+	if err := hdr.unmarshal(b); err != nil {
+		return nil, err
+	}
+	if hdr.Flags&CURVE_FLAG_PAGE_ALIGNED == 0 {
+		return nil, fmt.Errorf("%s is not page aligned, write it with SaveMapped or curve -mapped", filename)
+	}
+
+	xOff, yOff, length := hdr.layout()
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file stats: %w", err)
+	}
+	if stat.Size() != length {
+		return nil, fmt.Errorf("curve file of %d bytes does not match its header, order %d takes %d", stat.Size(), hdr.Order, length)
+	}
+
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(length), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mmap file: %w", err)
+	}
+
+	// the header was validated, check anyway that the coordinates lie in
+	// the mapping before making slices of them
+	size := int(hdr.points())
+	end := int(yOff) + size*int(hdr.Width)
+	if size == 0 || int(xOff)+size*int(hdr.Width) > int(yOff) || end > len(data) {
+		syscall.Munmap(data)
+		return nil, fmt.Errorf("corrupt curve header: order %d does not fit the %d byte file", hdr.Order, len(data))
+	}
+
+	curve := &HilbertCurve{Order: hdr.Order, Algorithm: hdr.Algorithm, mapped: data}
+	if hdr.Width == 2 {
+		curve.x16 = unsafe.Slice((*uint16)(unsafe.Pointer(&data[xOff])), size)
+		curve.y16 = unsafe.Slice((*uint16)(unsafe.Pointer(&data[yOff])), size)
+	} else {
+		// the slices are read only, writing to them faults
+		curve.X = unsafe.Slice((*uint32)(unsafe.Pointer(&data[xOff])), size)
+		curve.Y = unsafe.Slice((*uint32)(unsafe.Pointer(&data[yOff])), size)
+	}
+	return curve, nil
+}
+
+// Mapped reports whether the curve is backed by a mapped file
+func (curve *HilbertCurve) Mapped() bool {
+	return curve.mapped != nil
+}
+
+// Close unmaps a mapped curve, the curve must not be used afterwards. It does
+// nothing for loaded and computed curves.
+func (curve *HilbertCurve) Close() error {
+	if curve.mapped == nil {
+		return nil
+	}
+	err := syscall.Munmap(curve.mapped)
+	curve.mapped = nil
+	curve.x16, curve.y16 = nil, nil
+	curve.X, curve.Y = nil, nil
+	return err
+}
@@ -0,0 +1,92 @@
+package HuntingHash
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMmapSavedCurve(t *testing.T) {
+	dir := t.TempDir()
+	for _, alg := range []CurveAlgorithm{CURVE_GRAY, CURVE_HILBERT} {
+		for order := uint32(1); order <= 7; order++ {
+			want := tabulatedCurve(t, order, alg)
+			name := filepath.Join(dir, "curve.map")
+			if err := want.SaveMapped(name); err != nil {
+				t.Fatal(err)
+			}
+			got, err := MmapHilbertCurve(name)
+			if err != nil {
+				t.Fatalf("order %d %s: %v", order, alg, err)
+			}
+			if !got.Mapped() {
+				t.Fatalf("order %d %s: curve is not mapped", order, alg)
+			}
+			sameCurve(t, got, want)
+
+			// a mapped curve writes the file it was mapped from
+			copied := filepath.Join(dir, "copy.map")
+			if err := got.SaveMapped(copied); err != nil {
+				t.Fatal(err)
+			}
+			a, _ := os.ReadFile(name)
+			b, _ := os.ReadFile(copied)
+			if string(a) != string(b) {
+				t.Fatalf("order %d %s: rewriting a mapped curve changed the file", order, alg)
+			}
+			if err := got.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestMmapRejectsMismatchedFiles(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "curve.map")
+	if err := tabulatedCurve(t, 5, CURVE_GRAY).SaveMapped(name); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mapFile := func(content []byte) error {
+		t.Helper()
+		bad := filepath.Join(dir, "bad.map")
+		if err := os.WriteFile(bad, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		curve, err := MmapHilbertCurve(bad)
+		if err == nil {
+			curve.Close()
+		}
+		return err
+	}
+
+	if err := mapFile(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := mapFile(b[:len(b)-CURVE_PAGE_LEN]); err == nil {
+		t.Error("truncated curve file mapped")
+	}
+	if err := mapFile(append(b[:len(b):len(b)], make([]byte, CURVE_PAGE_LEN)...)); err == nil {
+		t.Error("curve file longer than its header mapped")
+	}
+
+	// the header of an order the format does not hold, on a file of the
+	// length it would have had when 4^16 wrapped to 0
+	for _, order := range []uint32{CURVE_MAX_ORDER + 1, 0} {
+		hdr := make([]byte, len(b))
+		copy(hdr, b)
+		binary.LittleEndian.PutUint32(hdr[12:], order)
+		if err := mapFile(hdr[:CURVE_PAGE_LEN]); err == nil {
+			t.Errorf("curve file of order %d mapped", order)
+		}
+		if err := mapFile(hdr); err == nil {
+			t.Errorf("curve file of order %d mapped", order)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package HuntingHash
+
+//
+// Copyright 2025 (c) By Rick Wesson & Support Intelligence, Inc.
+// Licenced under the RLL 1.0
+
+import (
+	"fmt"
+
+	"github.com/wessorh/rez"
+)
+
+// ResampleFilter selects the filter reducing the image of a buffer to its
+// voxel. The zero value is the three lobe lanczos filter every identifier
+// was built with until the filter could be chosen.
+type ResampleFilter uint8
+
+const (
+	FILTER_LANCZOS3 ResampleFilter = iota
+	FILTER_BOX                     // area average
+	FILTER_BILINEAR
+	FILTER_BICUBIC
+	FILTER_LANCZOS2
+)
+
+var filterNames = []string{
+	FILTER_LANCZOS3: "lanczos3",
+	FILTER_BOX:      "box",
+	FILTER_BILINEAR: "bilinear",
+	FILTER_BICUBIC:  "bicubic",
+	FILTER_LANCZOS2: "lanczos2",
+}
+
+// FilterNames lists the filters MapBufferFilter accepts, the default first
+func FilterNames() []string {
+	return append([]string(nil), filterNames...)
+}
+
+// ParseResampleFilter maps a name onto a ResampleFilter, the empty name is
+// the default
+func ParseResampleFilter(name string) (ResampleFilter, error) {
+	if name == "" {
+		return FILTER_LANCZOS3, nil
+	}
+	for f, n := range filterNames {
+		if n == name {
+			return ResampleFilter(f), nil
+		}
+	}
+	return FILTER_LANCZOS3, fmt.Errorf("unknown resampling filter %q, use one of %v", name, filterNames)
+}
+
+func (f ResampleFilter) String() string {
+	if int(f) < len(filterNames) {
+		return filterNames[f]
+	}
+	return fmt.Sprintf("filter(%d)", f)
+}
+
+func (f ResampleFilter) rez() rez.Filter {
+	switch f {
+	case FILTER_BOX:
+		return box{}
+	case FILTER_BILINEAR:
+		return rez.NewBilinearFilter()
+	case FILTER_BICUBIC:
+		return rez.NewBicubicFilter()
+	case FILTER_LANCZOS2:
+		return rez.NewLanczosFilter(2)
+	}
+	return rez.NewLanczosFilter(3)
+}
+
+// box weighs every source pixel under an output pixel equally, rez scales the
+// filter to the reduction so the output is the mean of its area
+type box struct{}
+
+func (box) Taps() int    { return 1 }
+func (box) Name() string { return "box" }
+
+func (box) Get(x float64) float64 {
+	if x < 0.5 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,113 @@
+package HuntingHash
+
+import (
+	"image"
+	"testing"
+)
+
+func TestParseResampleFilter(t *testing.T) {
+	for _, name := range FilterNames() {
+		f, err := ParseResampleFilter(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.String() != name {
+			t.Fatalf("ParseResampleFilter(%q) = %s", name, f)
+		}
+	}
+	if f, err := ParseResampleFilter(""); err != nil || f != FILTER_LANCZOS3 {
+		t.Fatalf("ParseResampleFilter(\"\") = %s, %v, want the default", f, err)
+	}
+	if _, err := ParseResampleFilter("nearest"); err == nil {
+		t.Fatal("an unknown filter parsed")
+	}
+}
+
+func TestBoxFilterAveragesItsArea(t *testing.T) {
+	// 16x16 pixels in 4x4 blocks, each a checkerboard of two values
+	im := image.NewGray(image.Rect(0, 0, 16, 16))
+	want := make([]byte, 16)
+	for by := range 4 {
+		for bx := range 4 {
+			a, b := byte(16*(4*by+bx)), byte(10*bx+7*by)
+			want[4*by+bx] = byte((int(a) + int(b)) / 2)
+			for y := 4 * by; y < 4*by+4; y++ {
+				for x := 4 * bx; x < 4*bx+4; x++ {
+					if (x+y)%2 == 0 {
+						im.Pix[16*y+x] = a
+					} else {
+						im.Pix[16*y+x] = b
+					}
+				}
+			}
+		}
+	}
+
+	got, err := ReduceWith(im, 4, FILTER_BOX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range want {
+		if d := int(got[i]) - int(want[i]); d < -1 || d > 1 {
+			t.Fatalf("box reduction %v, want the block means %v", got, want)
+		}
+	}
+}
+
+func TestFiltersKeepAUniformImage(t *testing.T) {
+	im := image.NewGray(image.Rect(0, 0, 64, 64))
+	for i := range im.Pix {
+		im.Pix[i] = 0x5a
+	}
+	for _, name := range FilterNames() {
+		f, _ := ParseResampleFilter(name)
+		for _, side := range []int{2, 4, 16} {
+			got, err := ReduceWith(im, side, f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, p := range got {
+				if d := int(p) - 0x5a; d < -1 || d > 1 {
+					t.Fatalf("%s %dx%d: %x, want every pixel 5a", name, side, side, got)
+				}
+			}
+		}
+	}
+}
+
+func TestFilterIsRecordedInTheIdentifier(t *testing.T) {
+	h := testHasher(t)
+	buffer := make([]byte, 30000)
+	for i := range buffer {
+		buffer[i] = byte(i * i >> 7)
+	}
+
+	plain, err := h.HashBytes(buffer, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []Identifier
+	for _, name := range FilterNames() {
+		f, _ := ParseResampleFilter(name)
+		res, err := h.HashBytesOptions(buffer, "", HashOptions{Filter: f})
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := res.Identifier()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id.Filter() != f {
+			t.Fatalf("%s recorded as %s", name, id.Filter())
+		}
+		if f == FILTER_LANCZOS3 && res.Id != plain.Id {
+			t.Fatalf("the default filter changed the identifier: %s, was %s", res.Id, plain.Id)
+		}
+		for _, other := range ids {
+			if id.SamePrefix(other) {
+				t.Fatalf("%s and %s are comparable", id, other)
+			}
+		}
+		ids = append(ids, id)
+	}
+}
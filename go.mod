@@ -5,8 +5,12 @@ go 1.23.5
 require (
 	github.com/OneOfOne/xxhash v1.2.8
 	github.com/bamiaux/rez v0.0.0-20170731184118-29f4463c688b
+	github.com/eciavatta/sdhash v0.0.0-20210117153940-a7b55306eeff
 	github.com/glaslos/ssdeep v0.4.0
+	github.com/glaslos/tlsh v0.3.0
+	github.com/hosom/gomagic v0.0.0-20160718182707-cbc00aac97a4
 	github.com/rs/zerolog v1.34.0
+	github.com/wessorh/rez v0.0.0-20250720003350-7c22d8c646d8
 	google.golang.org/grpc v1.72.0
 	google.golang.org/protobuf v1.36.5
 	gopkg.in/gographics/imagick.v2 v2.7.0
@@ -15,11 +19,8 @@ require (
 require (
 	github.com/Velocidex/go-magic v0.0.0-20250203094020-32f94b14f00f // indirect
 	github.com/datatogether/warc v0.0.0-20190806125150-74ef3f5ea69f // indirect
-	github.com/eciavatta/sdhash v0.0.0-20210117153940-a7b55306eeff // indirect
-	github.com/glaslos/tlsh v0.3.0 // indirect
 	github.com/go-redis/redis v6.15.9+incompatible // indirect
 	github.com/google/uuid v1.6.0 // indirect
-	github.com/hosom/gomagic v0.0.0-20160718182707-cbc00aac97a4 // indirect
 	github.com/jehiah/go-strftime v0.0.0-20171201141054-1d33003b3869 // indirect
 	github.com/klauspost/cpuid/v2 v2.2.3 // indirect
 	github.com/magefile/mage v1.15.0 // indirect
@@ -33,7 +34,6 @@ require (
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/tmthrgd/go-popcount v0.0.0-20190904054823-afb1ace8b04f // indirect
 	github.com/vimeo/go-magic v1.0.0 // indirect
-	github.com/wessorh/rez v0.0.0-20250720003350-7c22d8c646d8 // indirect
 	golang.org/x/net v0.35.0 // indirect
 	golang.org/x/sync v0.11.0 // indirect
 	golang.org/x/sys v0.30.0 // indirect
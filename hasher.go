@@ -0,0 +1,367 @@
+package HuntingHash
+
+//
+// Copyright 2025 (c) By Rick Wesson & Support Intelligence, Inc.
+// Licenced under the RLL 1.0
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/OneOfOne/xxhash"
+	"github.com/eciavatta/sdhash"
+	"github.com/glaslos/ssdeep"
+	"github.com/glaslos/tlsh"
+)
+
+const (
+	BUFFER_LEN_MIN = 64
+	DNA_MAGIC      = "dna/iching"
+)
+
+// stages of hashing a buffer reported to Hasher.Timings
+const (
+	STAGE_MAGIC    = "magic"    // classifying the buffer
+	STAGE_RESAMPLE = "resample" // mapping onto the curve and reducing the image
+	STAGE_SSDEEP   = "ssdeep"
+	STAGE_TLSH     = "tlsh"
+	STAGE_SDHASH   = "sdhash"
+	STAGE_PYRAMID  = "pyramid" // reducing the image to the other levels of the pyramid
+)
+
+// StageTimer is told how long each stage of hashing a buffer took, it is
+// called concurrently when buffers are hashed concurrently
+type StageTimer func(stage string, elapsed time.Duration)
+
+// Result holds everything the hasher computes for a single buffer, it
+// carries the same fields as the BufferResponse message returned by hollomand.
+type Result struct {
+	HOrder int32
+	Len    int32
+	Id     string
+	Magic  string
+	Ssdeep string
+	Sha1   string
+	Label  string
+	Tlsh   string
+	Sdhash string
+
+	// the 2x2, 8x8 and 16x16 identifiers when a pyramid was requested
+	Id2  string
+	Id8  string
+	Id16 string
+
+	// NormalizedMagic is the description hashed into the prefix, Magic
+	// after the hasher's normalisation rules
+	NormalizedMagic string
+}
+
+// HashOptions select how a buffer is reduced, they can be set per buffer
+type HashOptions struct {
+	Pyramid bool           // also compute the 2x2, 8x8 and 16x16 identifiers
+	Filter  ResampleFilter // reducing the image, recorded in the identifier
+}
+
+// Hasher turns buffers into Holloman identifiers. It can be embedded in any
+// Go program, hollomand is a thin wrapper around it.
+type Hasher struct {
+	Curve *HilbertCurve
+
+	DNA    bool // identifiers carry no magic, used for DNA clustering
+	Ssdeep bool // calculate ssdeep for buffers larger than 4096 bytes
+	Tlsh   bool // calculate TLSH for buffers larger than 256 bytes
+	Sdhash bool // calculate sdhash
+
+	HashOptions // defaults of HashBytes and NewStream
+
+	// Classifier describes buffers for the identifier prefix, nil for DNA
+	Classifier TypeClassifier
+
+	// Normalizer rewrites descriptions before they are hashed, nil hashes
+	// them as the classifier returns them
+	Normalizer *MagicNormalizer
+
+	// Timings is given the time spent in each stage, nil when not wanted
+	Timings StageTimer
+
+	// MaxStream bounds the length NewStream accepts, 0 for what the curve holds
+	MaxStream int64
+}
+
+// timed reports the time since start for stage
+func (h *Hasher) timed(stage string, start time.Time) {
+	if h.Timings != nil {
+		h.Timings(stage, time.Since(start))
+	}
+}
+
+// NewHasher returns a hasher mapping buffers onto curve. Unless dna is set
+// a libmagic classifier, a pool of GOMAXPROCS handles, is opened to build the
+// identifier prefix.
+func NewHasher(curve *HilbertCurve, dna bool) (h *Hasher, err error) {
+	if dna {
+		return NewClassifierHasher(curve, nil)
+	}
+	classifier, err := NewLibmagicClassifier(runtime.GOMAXPROCS(0))
+	if err != nil {
+		return nil, err
+	}
+	h, err = NewClassifierHasher(curve, classifier)
+	if err != nil {
+		classifier.Close()
+	}
+	return h, err
+}
+
+// NewClassifierHasher returns a hasher mapping buffers onto curve and taking
+// the identifier prefix from classifier, a nil classifier hashes DNA. The
+// hasher closes the classifier.
+func NewClassifierHasher(curve *HilbertCurve, classifier TypeClassifier) (*Hasher, error) {
+	if curve == nil {
+		return nil, fmt.Errorf("a hilbert curve is required")
+	}
+	return &Hasher{Curve: curve, DNA: classifier == nil, Classifier: classifier}, nil
+}
+
+// Close releases the classifier, it waits for lookups in progress
+func (h *Hasher) Close() error {
+	if h.Classifier != nil {
+		return h.Classifier.Close()
+	}
+	return nil
+}
+
+// MagicStats reports the use of the libmagic handles, it is zero for other
+// classifiers
+func (h *Hasher) MagicStats() MagicStats {
+	if c, ok := h.Classifier.(interface{ Stats() MagicStats }); ok {
+		return c.Stats()
+	}
+	return MagicStats{}
+}
+
+// Magic returns the classifier's description of buffer
+func (h *Hasher) Magic(buffer []byte) (string, error) {
+	if h.DNA {
+		return DNA_MAGIC, nil
+	}
+	if len(buffer) == 0 {
+		return "", fmt.Errorf("empty buffer")
+	}
+	if h.Classifier == nil {
+		return "", fmt.Errorf("the hasher has no type classifier")
+	}
+	return h.Classifier.Classify(buffer)
+}
+
+// HashBytes computes the identifier and the optional fuzzy hashes of buffer
+func (h *Hasher) HashBytes(buffer []byte, label string) (res *Result, err error) {
+	return h.HashBytesOptions(buffer, label, h.HashOptions)
+}
+
+// HashBytesOptions is HashBytes with opts in place of the hasher defaults
+func (h *Hasher) HashBytesOptions(buffer []byte, label string, opts HashOptions) (res *Result, err error) {
+	if len(buffer) < BUFFER_LEN_MIN {
+		return nil, fmt.Errorf("buffer length of %d is too small. minum length is %d", len(buffer), BUFFER_LEN_MIN)
+	}
+
+	res = &Result{Label: label, Len: int32(len(buffer))}
+
+	start := time.Now()
+	voxel, order, im, err := h.Curve.MapBufferFilter(buffer, opts.Filter)
+	if err != nil {
+		return nil, err
+	}
+	h.timed(STAGE_RESAMPLE, start)
+	res.HOrder = order
+
+	if err := h.identify(res, buffer, voxel, opts.Filter); err != nil {
+		return nil, err
+	}
+	if opts.Pyramid {
+		if err := h.pyramid(res, im, opts.Filter); err != nil {
+			return nil, err
+		}
+	}
+
+	// preform sha1 on buffer
+	sha := sha1.New()
+	sha.Write(buffer)
+	res.Sha1 = fmt.Sprintf("%40x", sha.Sum(nil))
+
+	if h.Ssdeep && len(buffer) > 4096 {
+		start := time.Now()
+		s, err := ssdeep.FuzzyBytes(buffer)
+		if err != nil {
+			s = err.Error()
+		}
+		res.Ssdeep = s
+		h.timed(STAGE_SSDEEP, start)
+	}
+
+	if h.Sdhash {
+		start := time.Now()
+		f, err := sdhash.CreateSdbfFromBytes(buffer)
+		if err == nil {
+			res.Sdhash = f.Compute().String()
+		}
+		h.timed(STAGE_SDHASH, start)
+	}
+
+	if h.Tlsh && len(buffer) > 256 {
+		start := time.Now()
+		f, err := tlsh.HashBytes(buffer)
+		if err == nil {
+			res.Tlsh = f.String()
+		}
+		h.timed(STAGE_TLSH, start)
+	}
+
+	return res, nil
+}
+
+// identify sets the magic, raw and normalized, and the identifier of res
+// from the voxel and the magic of head
+func (h *Hasher) identify(res *Result, head []byte, voxel []byte, filter ResampleFilter) (err error) {
+	if h.DNA {
+		res.Magic = DNA_MAGIC
+	} else {
+		start := time.Now()
+		res.Magic, err = h.Magic(head)
+		if err != nil {
+			return fmt.Errorf("error reading magic: %w", err)
+		}
+		h.timed(STAGE_MAGIC, start)
+	}
+	res.NormalizedMagic = h.Normalizer.Normalize(res.Magic)
+	res.Id, err = h.identifier(res.NormalizedMagic, res.HOrder, voxel, filter)
+	return err
+}
+
+func (h *Hasher) identifier(mgc string, order int32, voxel []byte, filter ResampleFilter) (string, error) {
+	var ident Identifier
+	var err error
+	if h.DNA {
+		ident, err = NewDNAIdentifier(int(order), voxel)
+	} else {
+		ident, err = NewIdentifier(int(order), MagicHash(mgc), voxel)
+	}
+	if err != nil {
+		return "", err
+	}
+	return ident.WithFilter(filter).String(), nil
+}
+
+// pyramid reduces im to the other levels, res already holds the magic
+func (h *Hasher) pyramid(res *Result, im *image.Gray, filter ResampleFilter) error {
+	defer h.timed(STAGE_PYRAMID, time.Now())
+	for _, side := range PYRAMID_SIDES {
+		voxel, err := ReduceWith(im, side, filter)
+		if err != nil {
+			return err
+		}
+		id, err := h.identifier(res.NormalizedMagic, res.HOrder, voxel, filter)
+		if err != nil {
+			return err
+		}
+		switch side {
+		case 2:
+			res.Id2 = id
+		case 8:
+			res.Id8 = id
+		case 16:
+			res.Id16 = id
+		}
+	}
+	return nil
+}
+
+// MagicHash is the xxhash32 of the first 60 characters of magic, left justified
+func MagicHash(magic string) uint32 {
+	return xxhash.ChecksumString32(fmt.Sprintf("%-60.60s", magic))
+}
+
+// Identifier parses the identifier of the result
+func (res *Result) Identifier() (Identifier, error) {
+	return ParseIdentifier(res.Id)
+}
+
+// Identifiers parses the identifier and, when there is one, the pyramid
+func (res *Result) Identifiers() ([]Identifier, error) {
+	return parseIdentifiers(res.Id, res.Id2, res.Id8, res.Id16)
+}
+
+func parseIdentifiers(ids ...string) ([]Identifier, error) {
+	var parsed []Identifier
+	for _, s := range ids {
+		if len(s) == 0 {
+			continue
+		}
+		id, err := ParseIdentifier(s)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, id)
+	}
+	return parsed, nil
+}
+
+// HashReader reads r to EOF and hashes its content
+func (h *Hasher) HashReader(r io.Reader, label string) (*Result, error) {
+	buffer, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading buffer: %w", err)
+	}
+	return h.HashBytes(buffer, label)
+}
+
+// HashFile memory maps filename and hashes its content, the filename is
+// used as the label.
+func (h *Hasher) HashFile(filename string) (*Result, error) {
+	buffer, err := MmapFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Munmap(buffer)
+
+	return h.HashBytes(buffer, filename)
+}
+
+// MmapFile maps filename read only into memory, release it with syscall.Munmap
+func MmapFile(filename string) ([]byte, error) {
+	// Open the file
+	file, err := os.OpenFile(filename, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	// Get the file size
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file stats: %w", err)
+	}
+	if stat.Size() < BUFFER_LEN_MIN {
+		return nil, fmt.Errorf("%s: file length of %d is too small. minum length is %d", filename, stat.Size(), BUFFER_LEN_MIN)
+	}
+
+	// Memory map the file
+	buffer, err := syscall.Mmap(
+		int(file.Fd()),
+		0,
+		int(stat.Size()),
+		syscall.PROT_READ,
+		syscall.MAP_SHARED,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mmap file: %w", err)
+	}
+
+	return buffer, nil
+}
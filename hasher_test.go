@@ -0,0 +1,89 @@
+package HuntingHash
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+var (
+	idFormat    = regexp.MustCompile(`^[c-z][0-9a-f]{8}\.[0-9a-f]{32}$`)
+	dnaIdFormat = regexp.MustCompile(`^[c-z]\.[0-9a-f]{32}$`)
+)
+
+func TestHashBytesIdentifierFormat(t *testing.T) {
+	h := testHasher(t)
+	buffer := make([]byte, 5000)
+	rand.New(rand.NewSource(1)).Read(buffer)
+
+	res, err := h.HashBytes(buffer, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !idFormat.MatchString(res.Id) {
+		t.Errorf("identifier %q is not %%c%%08x.%%32.32x", res.Id)
+	}
+
+	h.DNA = true
+	res, err = h.HashBytes(buffer, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dnaIdFormat.MatchString(res.Id) {
+		t.Errorf("DNA identifier %q is not %%c.%%032x", res.Id)
+	}
+}
+
+func TestHashBytesTooShort(t *testing.T) {
+	h := testHasher(t)
+	for _, n := range []int{0, 1, BUFFER_LEN_MIN - 1} {
+		if res, err := h.HashBytes(make([]byte, n), ""); err == nil {
+			t.Errorf("%d bytes hashed to %s", n, res.Id)
+		}
+	}
+	if _, err := h.HashBytes(make([]byte, BUFFER_LEN_MIN), ""); err != nil {
+		t.Errorf("%d bytes: %v", BUFFER_LEN_MIN, err)
+	}
+}
+
+func TestHashReaderAndFileMatchHashBytes(t *testing.T) {
+	h := testHasher(t)
+	dir := t.TempDir()
+	r := rand.New(rand.NewSource(2))
+	for _, n := range []int{BUFFER_LEN_MIN, 5000, 1 << 20} {
+		buffer := make([]byte, n)
+		r.Read(buffer)
+
+		want, err := h.HashBytes(buffer, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := h.HashReader(bytes.NewReader(buffer), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *got != *want {
+			t.Errorf("%d bytes: HashReader %+v, HashBytes %+v", n, got, want)
+		}
+
+		path := filepath.Join(dir, "buffer")
+		if err := os.WriteFile(path, buffer, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		got, err = h.HashFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the file name is the label
+		if got.Label != path {
+			t.Errorf("label %q, want %q", got.Label, path)
+		}
+		got.Label = want.Label
+		if *got != *want {
+			t.Errorf("%d bytes: HashFile %+v, HashBytes %+v", n, got, want)
+		}
+	}
+}
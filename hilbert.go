@@ -0,0 +1,121 @@
+package HuntingHash
+
+//
+// Copyright 2025 (c) By Rick Wesson & Support Intelligence, Inc.
+// Licenced under the RLL 1.0
+
+import (
+	"fmt"
+)
+
+const (
+	CURVE_CACHE_MAX = 14 // largest order tabulated by a computed curve, 2 GiB of coordinates
+)
+
+// CurveAlgorithm names the mapping from a buffer index to (x,y)
+type CurveAlgorithm uint8
+
+const (
+	CURVE_UNKNOWN CurveAlgorithm = iota
+	CURVE_GRAY                   // de-interleaved gray code, the mapping of the curve tool tables
+	CURVE_HILBERT                // hilbert curve with the rotate/flip step
+)
+
+// ParseCurveAlgorithm maps a name onto a CurveAlgorithm
+func ParseCurveAlgorithm(name string) (CurveAlgorithm, error) {
+	switch name {
+	case "gray":
+		return CURVE_GRAY, nil
+	case "hilbert":
+		return CURVE_HILBERT, nil
+	}
+	return CURVE_UNKNOWN, fmt.Errorf("unknown curve algorithm %q, use gray or hilbert", name)
+}
+
+func (a CurveAlgorithm) String() string {
+	switch a {
+	case CURVE_GRAY:
+		return "gray"
+	case CURVE_HILBERT:
+		return "hilbert"
+	}
+	return "unknown"
+}
+
+// NewComputedHilbertCurve returns a curve of order whose coordinates are
+// computed on the fly rather than loaded from a file. The points of orders up
+// to cacheOrder, the first 4^cacheOrder, are tabulated.
+func NewComputedHilbertCurve(order uint32, alg CurveAlgorithm, cacheOrder uint32) (*HilbertCurve, error) {
+	if order == 0 || order > CURVE_MAX_ORDER {
+		return nil, fmt.Errorf("curve order %d is out of range 1-%d", order, CURVE_MAX_ORDER)
+	}
+	if alg != CURVE_GRAY && alg != CURVE_HILBERT {
+		return nil, fmt.Errorf("curve algorithm %s can not be computed", alg)
+	}
+	curve := &HilbertCurve{Order: order, Algorithm: alg}
+
+	cacheOrder = min(cacheOrder, order, CURVE_CACHE_MAX)
+	if cacheOrder > 0 {
+		size := uint32(1) << (2 * cacheOrder)
+		curve.X = make([]uint32, size)
+		curve.Y = make([]uint32, size)
+		for i := uint32(0); i < size; i++ {
+			curve.X[i], curve.Y[i] = curve.compute(i)
+		}
+	}
+	return curve, nil
+}
+
+// Point returns the coordinates of index i, from the table when it holds i
+func (curve *HilbertCurve) Point(i uint32) (x, y uint32) {
+	if i < uint32(len(curve.x16)) {
+		return uint32(curve.x16[i]), uint32(curve.y16[i])
+	}
+	if i < uint32(len(curve.X)) {
+		return curve.X[i], curve.Y[i]
+	}
+	return curve.compute(i)
+}
+
+func (curve *HilbertCurve) compute(i uint32) (x, y uint32) {
+	if curve.Algorithm == CURVE_HILBERT {
+		return hilbertD2XY(curve.Order, i)
+	}
+	return grayD2XY(curve.Order, i)
+}
+
+// grayD2XY de-interleaves the gray code of d, odd bits into x and even bits into y
+func grayD2XY(order uint32, d uint32) (x, y uint32) {
+	gray := d ^ (d >> 1)
+	for j := uint32(0); j < order; j++ {
+		bit := (gray >> (2 * j)) & 3
+		x |= ((bit >> 1) & 1) << j
+		y |= (bit & 1) << j
+	}
+	return x, y
+}
+
+// hilbertD2XY is the classic iterative conversion of a distance along a
+// hilbert curve of order into (x,y), consecutive d are adjacent cells. Each
+// level past the last bits of d transposes the square, the levels are
+// rounded up to an even number so the first 4^k points are in the same
+// place whatever the order of the curve and a buffer gets one identifier.
+func hilbertD2XY(order uint32, d uint32) (x, y uint32) {
+	t := d
+	for level := uint32(0); level < (order+1)&^1; level++ {
+		s := uint32(1) << level
+		rx := 1 & (t >> 1)
+		ry := 1 & (t ^ rx)
+		if ry == 0 {
+			if rx == 1 {
+				x = s - 1 - x
+				y = s - 1 - y
+			}
+			x, y = y, x
+		}
+		x += s * rx
+		y += s * ry
+		t >>= 2
+	}
+	return x, y
+}
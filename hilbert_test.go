@@ -0,0 +1,158 @@
+package HuntingHash
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeCurveTable writes a table the way the curve tool does: a gzipped
+// little-endian uint32 order followed by the X then the Y coordinates. The
+// coordinates come from a copy of the curve tool generator.
+func writeCurveTable(t *testing.T, order uint32) string {
+	t.Helper()
+
+	size := uint32(1) << (2 * order)
+	x := make([]uint32, size)
+	y := make([]uint32, size)
+	for i := uint32(0); i < size; i++ {
+		gray := i ^ (i >> 1)
+		mask := uint32(1)
+		for j := uint32(0); j < order; j++ {
+			bit := (gray >> (2 * j)) & 3
+			if (bit>>1)&1 != 0 {
+				x[i] |= mask
+			}
+			if bit&1 != 0 {
+				y[i] |= mask
+			}
+			mask <<= 1
+		}
+	}
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	binary.Write(gw, binary.LittleEndian, order)
+	binary.Write(gw, binary.LittleEndian, x)
+	binary.Write(gw, binary.LittleEndian, y)
+	gw.Close()
+
+	name := filepath.Join(t.TempDir(), "hilbert_curve.dat.gz")
+	if err := os.WriteFile(name, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestComputedCurveMatchesTable(t *testing.T) {
+	const order = 8
+
+	table, err := LoadHilbertCurve(writeCurveTable(t, order))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cache := range []uint32{0, 3, order} {
+		computed, err := NewComputedHilbertCurve(order, CURVE_GRAY, cache)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := uint32(0); i < 1<<(2*order); i++ {
+			tx, ty := table.X[i], table.Y[i]
+			if cx, cy := computed.Point(i); cx != tx || cy != ty {
+				t.Fatalf("cache %d: point %d is (%d,%d), the table has (%d,%d)", cache, i, cx, cy, tx, ty)
+			}
+		}
+
+		r := rand.New(rand.NewSource(int64(cache)))
+		for _, n := range []int{64, 1000, 4096, 50000, 1 << (2 * order)} {
+			buffer := make([]byte, n)
+			r.Read(buffer)
+
+			want, wantOrder, _, err := table.MapBuffer(buffer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, gotOrder, _, err := computed.MapBuffer(buffer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gotOrder != wantOrder || !bytes.Equal(got, want) {
+				t.Errorf("cache %d, %d bytes: voxel %x order %d, the table gives %x order %d", cache, n, got, gotOrder, want, wantOrder)
+			}
+		}
+	}
+}
+
+func TestComputedHilbertCurveIsContinuous(t *testing.T) {
+	for order := uint32(1); order <= 6; order++ {
+		curve, err := NewComputedHilbertCurve(order, CURVE_HILBERT, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := uint32(1) << (2 * order)
+		seen := make(map[[2]uint32]bool, size)
+		px, py := curve.Point(0)
+		for i := uint32(0); i < size; i++ {
+			x, y := curve.Point(i)
+			if x >= 1<<order || y >= 1<<order || seen[[2]uint32{x, y}] {
+				t.Fatalf("order %d: point %d (%d,%d) is outside the square or repeated", order, i, x, y)
+			}
+			seen[[2]uint32{x, y}] = true
+			if i > 0 && absDiff(x, px)+absDiff(y, py) != 1 {
+				t.Fatalf("order %d: point %d (%d,%d) is not adjacent to (%d,%d)", order, i, x, y, px, py)
+			}
+			px, py = x, y
+		}
+	}
+}
+
+func absDiff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+func TestComputedCurveOrderDoesNotChangeIdentifiers(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	buffer := make([]byte, 3000)
+	r.Read(buffer)
+
+	for _, alg := range []CurveAlgorithm{CURVE_GRAY, CURVE_HILBERT} {
+		small, err := NewComputedHilbertCurve(6, alg, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _, _, err := small.MapBuffer(buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, order := range []uint32{7, 8, CURVE_MAX_ORDER - 1, CURVE_MAX_ORDER} {
+			curve, err := NewComputedHilbertCurve(order, alg, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := uint32(0); i < 1<<(2*6); i++ {
+				if x, y := curve.Point(i); x >= 1<<6 || y >= 1<<6 {
+					t.Fatalf("%s order %d: point %d (%d,%d) is outside the order 6 square", alg, order, i, x, y)
+				}
+			}
+			got, _, _, err := curve.MapBuffer(buffer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s order %d: voxel %x, order 6 gives %x", alg, order, got, want)
+			}
+		}
+	}
+
+	if _, err := NewComputedHilbertCurve(CURVE_MAX_ORDER+1, CURVE_GRAY, 0); err == nil {
+		t.Errorf("computed curve of order %d accepted", CURVE_MAX_ORDER+1)
+	}
+}
@@ -3,13 +3,10 @@
 package HuntingHash
 
 import (
-    "compress/gzip"
-    "encoding/binary"
     //"bytes"
     "image"
     //"math"
     "fmt"
-    "os"
 
 	//"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -27,56 +24,13 @@ type HilbertCurve struct {
     Order uint32
     X     []uint32
     Y     []uint32
-}
-
-// LoadHilbertCurve reads a gzipped Hilbert curve from a file and returns it
-func LoadHilbertCurve(filename string) (*HilbertCurve, error) {
-    // Open the file for reading
-    file, err := os.Open(filename)
-    if err != nil {
-        return nil, fmt.Errorf("error opening file: %w", err)
-    }
-    defer file.Close()
-
-    // Create a gzip reader
-    gzReader, err := gzip.NewReader(file)
-    if err != nil {
-        return nil, fmt.Errorf("error creating gzip reader: %w", err)
-    }
-    defer gzReader.Close()
-
-    // Create a new HilbertCurve struct
-    curve := &HilbertCurve{}
-
-    // Read the order
-    err = binary.Read(gzReader, binary.LittleEndian, &curve.Order)
-    if err != nil {
-        return nil, fmt.Errorf("error reading order: %w", err)
-    }
-
-    // Calculate size based on order
-    size := uint32(1 << (2 * curve.Order))
-
-    // Initialize slices
-    curve.X = make([]uint32, size)
-    curve.Y = make([]uint32, size)
+    Algorithm CurveAlgorithm
 
-    // Read X coordinates
-    err = binary.Read(gzReader, binary.LittleEndian, curve.X)
-    if err != nil {
-        return nil, fmt.Errorf("error reading X coordinates: %w", err)
-    }
-
-    // Read Y coordinates
-    err = binary.Read(gzReader, binary.LittleEndian, curve.Y)
-    if err != nil {
-        return nil, fmt.Errorf("error reading Y coordinates: %w", err)
-    }
-
-    return curve, nil
+    // 16 bit coordinates of a mapped curve file and the mapping
+    x16, y16 []uint16
+    mapped   []byte
 }
 
-
 func HilbertCurveOrder(n int64) int {
     if n <= 0 {
         return 0
@@ -102,50 +56,89 @@ func (curve *HilbertCurve) MapPoint(i, order int) ( x,y uint32, err error){
 	}
 
 	// rotate
-	x = curve.Y[ i ];
-    y = curve.X[ i ];
+	y, x = curve.Point(uint32(i))
 
     return x, y, nil
 }
 
 func (curve *HilbertCurve) MapBuffer(buffer []byte) (outputBuffer []byte, order int32, im *image.Gray, err error){
+	return curve.MapBufferFilter(buffer, FILTER_LANCZOS3)
+}
+
+// MapBufferFilter is MapBuffer reducing the image with filter
+func (curve *HilbertCurve) MapBufferFilter(buffer []byte, filter ResampleFilter) (outputBuffer []byte, order int32, im *image.Gray, err error){
 
 	// is the curve large enough?
-	order = int32(HilbertCurveOrder(int64(len(buffer))))
-	if order > int32(curve.Order) {
-		return nil, 0, nil, fmt.Errorf("buffer too large, max order %d, it requires a curve of at least order %d", curve.Order, order)
+	im, order, err = curve.NewImage(int64(len(buffer)))
+	if err != nil {
+		return nil, 0, nil, err
 	}
- 	stride := uint32(1 << order)  // 2^order
-    total_points := stride * stride
-    in_len := uint32(len(buffer))
-    im = image.NewGray(image.Rect(0, 0, int(stride), int(stride)))
-
-    //tmpBuffer := make([]byte, total_points);
-
-        for i := uint32(0); i < in_len; i++ {
-        	// rotates the image
-            x := curve.Y[ i ];
-            y := curve.X[ i ];
-            index := (y * stride) + x;
-            //printf("%ld (%d,%d) %d %ld %ld\n", i+offset, x, y, index, bytes_read, offset);
-            // ensure that the indexes are within the bounds of output_buffer
-            if (i < in_len && index < total_points) {
-                im.Pix[index] = buffer[i];
-            }
-        }
-
-    //im.Pix = tmpBuffer
-	output_im2 := image.NewGray(image.Rect(0, 0, 4, 4))
+	curve.Plot(im, 0, buffer)
 
-	err = rez.Convert(output_im2, im, rez.NewLanczosFilter(3))
+	outputBuffer, err = ReduceWith(im, VOXEL_SIDE, filter)
 	if err != nil {
 		log.Error().Msg(err.Error())
 	}
 
-	outputBuffer = output_im2.Pix
+	return outputBuffer, order, im, nil 
+}
+
+// NewImage returns the blank image a buffer of length bytes is mapped onto
+// and the order of the curve it requires
+func (curve *HilbertCurve) NewImage(length int64) (im *image.Gray, order int32, err error) {
+	order = int32(HilbertCurveOrder(length))
+	if order > int32(curve.Order) {
+		return nil, 0, fmt.Errorf("buffer too large, max order %d, it requires a curve of at least order %d", curve.Order, order)
+	}
+	stride := 1 << order // 2^order
+	im = image.NewGray(image.Rect(0, 0, stride, stride))
 
+	return im, order, nil
+}
 
-	return outputBuffer, order, im, nil 
+// Plot maps chunk, found at offset in the buffer, onto im. Chunks may be
+// plotted in any order, bytes beyond the image are ignored.
+func (curve *HilbertCurve) Plot(im *image.Gray, offset int64, chunk []byte) {
+	stride := uint32(im.Rect.Dx())
+	total_points := uint32(len(im.Pix))
+	if offset < 0 || offset >= int64(total_points) {
+		return
+	}
+	start := uint32(offset)
+
+	for j := range chunk {
+		i := start + uint32(j)
+		if i >= total_points {
+			break
+		}
+		// rotates the image
+		y, x := curve.Point(i)
+		index := (y * stride) + x
+		// ensure that the indexes are within the bounds of output_buffer
+		if index < total_points {
+			im.Pix[index] = chunk[j]
+		}
+	}
+}
+
+// Reduce resamples the image of a buffer to the 4x4 voxel of its identifier
+func Reduce(im *image.Gray) ([]byte, error) {
+	return ReduceTo(im, VOXEL_SIDE)
+}
+
+// ReduceTo resamples the image of a buffer to a side x side voxel, the levels
+// of the identifier pyramid
+func ReduceTo(im *image.Gray, side int) ([]byte, error) {
+	return ReduceWith(im, side, FILTER_LANCZOS3)
+}
+
+// ReduceWith resamples the image of a buffer to a side x side voxel with filter
+func ReduceWith(im *image.Gray, side int, filter ResampleFilter) ([]byte, error) {
+	output_im2 := image.NewGray(image.Rect(0, 0, side, side))
+
+	err := rez.Convert(output_im2, im, filter.rez())
+
+	return output_im2.Pix, err
 }
 
 // PrintImage4x4 prints a 4x4 image in hexadecimal format
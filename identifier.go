@@ -0,0 +1,273 @@
+package HuntingHash
+
+//
+// Copyright 2025 (c) By Rick Wesson & Support Intelligence, Inc.
+// Licenced under the RLL 1.0
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+const (
+	VOXEL_LEN  = 16 // bytes in the suffix, a 4x4 grayscale image
+	VOXEL_SIDE = 4  // side of the standard reduction
+)
+
+// PYRAMID_SIDES are the sides of the additional reductions of a pyramid
+var PYRAMID_SIDES = []int{2, 8, 16}
+
+// Identifier is a parsed Holloman identifier. The prefix is the order of the
+// curve and, for files, the xxhash32 of the magic; the suffix is the reduced
+// image. DNA identifiers have no magic hash.
+//
+// Reductions other than the standard 4x4 lanczos3 one carry a metadata
+// segment between the prefix and the suffix, dash separated tokens naming
+// the level and the filter: j362e4894.x8-box.<128 hex digits> is the 8x8 box
+// filtered reduction. Only identifiers with the same metadata are comparable.
+type Identifier struct {
+	order  int
+	magic  uint32
+	dna    bool
+	side   int            // of the reduced image, the suffix is side*side bytes
+	filter ResampleFilter // that reduced the image
+	voxel  string         // raw suffix bytes, a string keeps Identifier comparable
+}
+
+// NewIdentifier builds a file identifier from its parts, the level is taken
+// from the length of voxel
+func NewIdentifier(order int, magicHash uint32, voxel []byte) (Identifier, error) {
+	side, err := checkIdentifierParts(order, voxel)
+	if err != nil {
+		return Identifier{}, err
+	}
+	return Identifier{order: order, magic: magicHash, side: side, voxel: string(voxel)}, nil
+}
+
+// NewDNAIdentifier builds a DNA identifier, it has no magic hash
+func NewDNAIdentifier(order int, voxel []byte) (Identifier, error) {
+	side, err := checkIdentifierParts(order, voxel)
+	if err != nil {
+		return Identifier{}, err
+	}
+	return Identifier{order: order, dna: true, side: side, voxel: string(voxel)}, nil
+}
+
+func checkIdentifierParts(order int, voxel []byte) (side int, err error) {
+	if order < 2 || order >= len(ORDER_ALPHABET) {
+		return 0, fmt.Errorf("order %d is outside the identifier alphabet", order)
+	}
+	side = voxelSide(len(voxel))
+	if side == 0 {
+		return 0, fmt.Errorf("voxel is %d bytes, expected %d or a pyramid level", len(voxel), VOXEL_LEN)
+	}
+	return side, nil
+}
+
+// voxelSide returns the side of a voxel of n bytes, zero when no level has n
+func voxelSide(n int) int {
+	if n == VOXEL_LEN {
+		return VOXEL_SIDE
+	}
+	for _, side := range PYRAMID_SIDES {
+		if side*side == n {
+			return side
+		}
+	}
+	return 0
+}
+
+// ParseIdentifier parses identifiers such as j362e4894.23655e5f5a6264630807270e00000000,
+// DNA identifiers such as c.23655e5f5a6264630807270e00000000 and identifiers
+// with a metadata segment such as j362e4894.x2-bicubic.23655e5f. Only the
+// form String returns is accepted: lowercase hex, the level before the
+// filter and neither the default x4 level nor the lanczos3 filter spelled out.
+func ParseIdentifier(s string) (Identifier, error) {
+	var id Identifier
+
+	prefix, suffix, ok := strings.Cut(s, ".")
+	if !ok {
+		return Identifier{}, fmt.Errorf("identifier %q has no suffix", s)
+	}
+	if len(prefix) == 0 {
+		return Identifier{}, fmt.Errorf("identifier %q has no prefix", s)
+	}
+
+	id.order = strings.IndexByte(ORDER_ALPHABET[2:], prefix[0]) + 2
+	if id.order < 2 {
+		return Identifier{}, fmt.Errorf("identifier %q has an invalid order %q", s, prefix[0])
+	}
+
+	switch len(prefix) {
+	case 1:
+		id.dna = true
+	case 9:
+		m, err := strconv.ParseUint(prefix[1:], 16, 32)
+		if err != nil {
+			return Identifier{}, fmt.Errorf("identifier %q has an invalid magic hash: %w", s, err)
+		}
+		id.magic = uint32(m)
+	default:
+		return Identifier{}, fmt.Errorf("identifier %q has a malformed prefix", s)
+	}
+
+	id.side = VOXEL_SIDE
+	if meta, rest, ok := strings.Cut(suffix, "."); ok {
+		if err := id.parseMeta(meta); err != nil {
+			return Identifier{}, fmt.Errorf("identifier %q: %w", s, err)
+		}
+		suffix = rest
+	}
+
+	if len(suffix) != 2*id.side*id.side {
+		return Identifier{}, fmt.Errorf("identifier %q suffix is %d characters, expected %d", s, len(suffix), 2*id.side*id.side)
+	}
+	voxel, err := hex.DecodeString(suffix)
+	if err != nil {
+		return Identifier{}, fmt.Errorf("identifier %q has an invalid suffix: %w", s, err)
+	}
+	id.voxel = string(voxel)
+
+	// every identifier has a single spelling, so that a parsed identifier
+	// formats back to the string it came from
+	if c := id.String(); c != s {
+		return Identifier{}, fmt.Errorf("identifier %q is not canonical, expected %q", s, c)
+	}
+	return id, nil
+}
+
+// parseMeta reads the dash separated tokens of the metadata segment
+func (id *Identifier) parseMeta(meta string) error {
+	for _, token := range strings.Split(meta, "-") {
+		if len(token) > 1 && token[0] == 'x' {
+			side, err := strconv.Atoi(token[1:])
+			if err != nil || (side != VOXEL_SIDE && voxelSide(side*side) == 0) {
+				return fmt.Errorf("unknown level %q", token)
+			}
+			id.side = side
+			continue
+		}
+		if f, err := ParseResampleFilter(token); err == nil && len(token) > 0 {
+			id.filter = f
+			continue
+		}
+		return fmt.Errorf("unknown metadata %q", token)
+	}
+	return nil
+}
+
+// WithFilter returns the identifier recording that filter reduced its image
+func (id Identifier) WithFilter(filter ResampleFilter) Identifier {
+	id.filter = filter
+	return id
+}
+
+// Filter returns the filter that reduced the image
+func (id Identifier) Filter() ResampleFilter {
+	return id.filter
+}
+
+// Meta returns the metadata segment, empty for the standard reduction
+func (id Identifier) Meta() string {
+	var tokens []string
+	if id.side != VOXEL_SIDE && id.side != 0 {
+		tokens = append(tokens, fmt.Sprintf("x%d", id.side))
+	}
+	if id.filter != FILTER_LANCZOS3 {
+		tokens = append(tokens, id.filter.String())
+	}
+	return strings.Join(tokens, "-")
+}
+
+// String formats the identifier the same way hollomand does
+func (id Identifier) String() string {
+	if meta := id.Meta(); len(meta) > 0 {
+		return fmt.Sprintf("%s.%s.%x", id.Prefix(), meta, id.voxel)
+	}
+	return fmt.Sprintf("%s.%x", id.Prefix(), id.voxel)
+}
+
+// Prefix returns the order and magic part of the identifier
+func (id Identifier) Prefix() string {
+	if id.dna {
+		return fmt.Sprintf("%c", ORDER_ALPHABET[id.order])
+	}
+	return fmt.Sprintf("%c%08x", ORDER_ALPHABET[id.order], id.magic)
+}
+
+// partition is the prefix and the metadata, only identifiers sharing it are
+// comparable
+func (id Identifier) partition() string {
+	if meta := id.Meta(); len(meta) > 0 {
+		return id.Prefix() + "." + meta
+	}
+	return id.Prefix()
+}
+
+// Order returns the order of the curve the buffer was mapped onto
+func (id Identifier) Order() int {
+	return id.order
+}
+
+// MagicHash returns the xxhash32 of the padded magic, zero for DNA
+func (id Identifier) MagicHash() uint32 {
+	return id.magic
+}
+
+// IsDNA reports if the identifier was produced for a DNA sequence
+func (id Identifier) IsDNA() bool {
+	return id.dna
+}
+
+// Level returns the side of the reduced image, 4 for the standard identifier
+func (id Identifier) Level() int {
+	return id.side
+}
+
+// Voxel returns a copy of the suffix, Level*Level grayscale pixels in row order
+func (id Identifier) Voxel() []byte {
+	return []byte(id.voxel)
+}
+
+// SamePrefix reports if two identifiers may be compared by distance, they
+// share the prefix, the level and the filter
+func (id Identifier) SamePrefix(other Identifier) bool {
+	return id.order == other.order && id.dna == other.dna && id.magic == other.magic &&
+		id.side == other.side && id.filter == other.filter
+}
+
+// HammingDistance counts the bits that differ between the suffixes
+func HammingDistance(a, b Identifier) int {
+	d := 0
+	for i := 0; i < len(a.voxel) && i < len(b.voxel); i++ {
+		d += bits.OnesCount8(a.voxel[i] ^ b.voxel[i])
+	}
+	return d
+}
+
+// L1Distance sums the absolute per-pixel difference between the suffixes
+func L1Distance(a, b Identifier) int {
+	d := 0
+	for i := 0; i < len(a.voxel) && i < len(b.voxel); i++ {
+		p := int(a.voxel[i]) - int(b.voxel[i])
+		if p < 0 {
+			p = -p
+		}
+		d += p
+	}
+	return d
+}
+
+// L2Distance is the euclidean distance between the suffixes as pixel vectors
+func L2Distance(a, b Identifier) float64 {
+	d := 0
+	for i := 0; i < len(a.voxel) && i < len(b.voxel); i++ {
+		p := int(a.voxel[i]) - int(b.voxel[i])
+		d += p * p
+	}
+	return math.Sqrt(float64(d))
+}
@@ -0,0 +1,57 @@
+package HuntingHash
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIdentifierRoundTrip(t *testing.T) {
+	voxel := func(side int) string { return strings.Repeat("0f", side*side) }
+	for _, s := range []string{
+		"j362e4894." + voxel(4),
+		"c." + voxel(4),
+		"j00000000." + voxel(4),
+		"j362e4894.x2." + voxel(2),
+		"j362e4894.x8-box." + voxel(8),
+		"j362e4894.x16-lanczos2." + voxel(16),
+		"j362e4894.bicubic." + voxel(4),
+		"c.x8-bilinear." + voxel(8),
+	} {
+		id, err := ParseIdentifier(s)
+		if err != nil {
+			t.Fatalf("ParseIdentifier(%q): %v", s, err)
+		}
+		if id.String() != s {
+			t.Fatalf("ParseIdentifier(%q).String() = %q", s, id.String())
+		}
+		again, err := ParseIdentifier(id.String())
+		if err != nil || again != id {
+			t.Fatalf("%q did not parse back to the same identifier: %v", s, err)
+		}
+	}
+}
+
+func TestParseIdentifierRejectsNonCanonical(t *testing.T) {
+	voxel := func(side int) string { return strings.Repeat("0f", side*side) }
+	for _, tc := range []struct {
+		name, s string
+	}{
+		{"uppercase magic", "j362E4894." + voxel(4)},
+		{"uppercase suffix", "j362e4894." + strings.ToUpper(voxel(4))},
+		{"default level", "j362e4894.x4." + voxel(4)},
+		{"default filter", "j362e4894.lanczos3." + voxel(4)},
+		{"default level and filter", "j362e4894.x4-lanczos3." + voxel(4)},
+		{"filter before level", "j362e4894.box-x8." + voxel(8)},
+		{"padded level", "j362e4894.x08." + voxel(8)},
+		{"repeated level", "j362e4894.x8-x8." + voxel(8)},
+		{"repeated filter", "j362e4894.box-box." + voxel(4)},
+		{"empty metadata", "j362e4894.." + voxel(4)},
+		{"unknown level", "j362e4894.x3." + voxel(3)},
+		{"short suffix", "j362e4894." + voxel(2)},
+		{"short magic", "j362e489." + voxel(4)},
+	} {
+		if id, err := ParseIdentifier(tc.s); err == nil {
+			t.Fatalf("%s: ParseIdentifier(%q) = %s, want an error", tc.name, tc.s, id)
+		}
+	}
+}
@@ -0,0 +1,417 @@
+package HuntingHash
+
+//
+// Copyright 2025 (c) By Rick Wesson & Support Intelligence, Inc.
+// Licenced under the RLL 1.0
+
+import (
+	"sort"
+	"sync"
+)
+
+// Metric measures the distance between two identifiers sharing a prefix,
+// it must satisfy the triangle inequality for the index to be exact.
+type Metric func(a, b Identifier) int
+
+// IndexEntry is a sample held by a SimilarityIndex
+type IndexEntry struct {
+	Id    Identifier
+	Label string
+	Sha1  string
+}
+
+// Neighbor is an entry returned by a query with its distance to the query
+type Neighbor struct {
+	IndexEntry
+	Distance int
+}
+
+// SimilarityIndex answers nearest neighbour queries over identifiers. It is
+// partitioned by prefix and level, only identifiers sharing both are
+// comparable, and each partition is a BK-tree over the suffix. It is safe for
+// concurrent use.
+type SimilarityIndex struct {
+	mu     sync.RWMutex
+	metric Metric
+	parts  map[string]*bkTree
+	size   int
+}
+
+// NewSimilarityIndex returns an empty index, HammingDistance is used when
+// metric is nil.
+func NewSimilarityIndex(metric Metric) *SimilarityIndex {
+	if metric == nil {
+		metric = HammingDistance
+	}
+	return &SimilarityIndex{
+		metric: metric,
+		parts:  make(map[string]*bkTree),
+	}
+}
+
+// Len returns the number of entries in the index
+func (idx *SimilarityIndex) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.size
+}
+
+// Partitions returns the number of distinct prefixes in the index
+func (idx *SimilarityIndex) Partitions() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.parts)
+}
+
+// Insert adds e to the index. An entry with the same identifier and SHA-1
+// is replaced.
+func (idx *SimilarityIndex) Insert(e IndexEntry) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	key := e.Id.partition()
+	t, ok := idx.parts[key]
+	if !ok {
+		t = &bkTree{metric: idx.metric}
+		idx.parts[key] = t
+	}
+	if t.insert(e) {
+		idx.size++
+	}
+}
+
+// Delete removes the entries for id, when sha1 is not empty only the entry
+// with that SHA-1 is removed. The removed entries are returned.
+func (idx *SimilarityIndex) Delete(id Identifier, sha1 string) []IndexEntry {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	key := id.partition()
+	t, ok := idx.parts[key]
+	if !ok {
+		return nil
+	}
+	removed := t.delete(id, sha1)
+	idx.size -= len(removed)
+	if t.live == 0 {
+		delete(idx.parts, key)
+	}
+	return removed
+}
+
+// DeleteLevels removes the entries of sha1 at the other levels of the
+// pyramid of id, the same prefix and filter reduced to another side. It
+// walks those partitions, callers that know the identifiers of the other
+// levels delete them instead.
+func (idx *SimilarityIndex) DeleteLevels(id Identifier, sha1 string) (removed []IndexEntry) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for _, side := range append([]int{VOXEL_SIDE}, PYRAMID_SIDES...) {
+		if side == id.side {
+			continue
+		}
+		level := id
+		level.side = side
+		key := level.partition()
+		t, ok := idx.parts[key]
+		if !ok {
+			continue
+		}
+		var ids []Identifier
+		t.walk(t.root, func(e IndexEntry) bool {
+			if e.Sha1 == sha1 {
+				ids = append(ids, e.Id)
+			}
+			return true
+		})
+		for _, other := range ids {
+			r := t.delete(other, sha1)
+			idx.size -= len(r)
+			removed = append(removed, r...)
+		}
+		if t.live == 0 {
+			delete(idx.parts, key)
+		}
+	}
+	return removed
+}
+
+// Nearest returns up to k entries closest to id, nearest first. Entries
+// further than maxDistance are ignored, a negative maxDistance means no limit.
+// Entries at the same distance are ordered by identifier then SHA-1, so the
+// k returned do not depend on the order they were inserted.
+func (idx *SimilarityIndex) Nearest(id Identifier, k int, maxDistance int) []Neighbor {
+	if k <= 0 {
+		return nil
+	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	t, ok := idx.parts[id.partition()]
+	if !ok {
+		return nil
+	}
+	return t.nearest(id, k, maxDistance)
+}
+
+// Radius returns every entry within distance r of id, nearest first
+func (idx *SimilarityIndex) Radius(id Identifier, r int) []Neighbor {
+	if r < 0 {
+		return nil
+	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	t, ok := idx.parts[id.partition()]
+	if !ok {
+		return nil
+	}
+	res := t.radius(id, r)
+	sortNeighbors(res)
+	return res
+}
+
+// Range calls fn for every entry in the index until fn returns false
+func (idx *SimilarityIndex) Range(fn func(IndexEntry) bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	for _, t := range idx.parts {
+		if !t.walk(t.root, fn) {
+			return
+		}
+	}
+}
+
+func sortNeighbors(res []Neighbor) {
+	sort.Slice(res, func(i, j int) bool { return res[i].less(res[j]) })
+}
+
+// less orders neighbours by distance, identifier and SHA-1, the identifiers
+// share a partition so their voxels order them
+func (n Neighbor) less(o Neighbor) bool {
+	if n.Distance != o.Distance {
+		return n.Distance < o.Distance
+	}
+	if n.Id != o.Id {
+		return n.Id.voxel < o.Id.voxel
+	}
+	return n.Sha1 < o.Sha1
+}
+
+// bkNode holds every entry sharing one identifier, a node whose entries
+// were deleted is kept to route searches to its children.
+type bkNode struct {
+	id       Identifier
+	entries  []IndexEntry
+	children map[int]*bkNode
+}
+
+type bkTree struct {
+	metric Metric
+	root   *bkNode
+	live   int // entries
+	dead   int // nodes without entries
+}
+
+// insert returns true when a new entry was added
+func (t *bkTree) insert(e IndexEntry) bool {
+	if t.root == nil {
+		t.root = &bkNode{id: e.Id, entries: []IndexEntry{e}}
+		t.live++
+		return true
+	}
+
+	node := t.root
+	for {
+		d := t.metric(node.id, e.Id)
+		if d == 0 && node.id == e.Id {
+			for i := range node.entries {
+				if node.entries[i].Sha1 == e.Sha1 {
+					node.entries[i] = e
+					return false
+				}
+			}
+			if len(node.entries) == 0 {
+				t.dead--
+			}
+			node.entries = append(node.entries, e)
+			t.live++
+			return true
+		}
+		child, ok := node.children[d]
+		if !ok {
+			if node.children == nil {
+				node.children = make(map[int]*bkNode)
+			}
+			node.children[d] = &bkNode{id: e.Id, entries: []IndexEntry{e}}
+			t.live++
+			return true
+		}
+		node = child
+	}
+}
+
+func (t *bkTree) find(id Identifier) *bkNode {
+	node := t.root
+	for node != nil {
+		d := t.metric(node.id, id)
+		if d == 0 && node.id == id {
+			return node
+		}
+		node = node.children[d]
+	}
+	return nil
+}
+
+func (t *bkTree) delete(id Identifier, sha1 string) (removed []IndexEntry) {
+	node := t.find(id)
+	if node == nil || len(node.entries) == 0 {
+		return nil
+	}
+
+	kept := node.entries[:0]
+	for _, e := range node.entries {
+		if sha1 == "" || e.Sha1 == sha1 {
+			removed = append(removed, e)
+		} else {
+			kept = append(kept, e)
+		}
+	}
+	node.entries = kept
+	t.live -= len(removed)
+	if len(kept) == 0 && len(removed) > 0 {
+		t.dead++
+	}
+
+	// rebuild once routing nodes outnumber live ones
+	if t.dead > 64 && t.dead > t.live {
+		t.rebuild()
+	}
+	return removed
+}
+
+func (t *bkTree) rebuild() {
+	var entries []IndexEntry
+	t.walk(t.root, func(e IndexEntry) bool {
+		entries = append(entries, e)
+		return true
+	})
+	t.root, t.live, t.dead = nil, 0, 0
+	for _, e := range entries {
+		t.insert(e)
+	}
+}
+
+func (t *bkTree) walk(node *bkNode, fn func(IndexEntry) bool) bool {
+	if node == nil {
+		return true
+	}
+	for _, e := range node.entries {
+		if !fn(e) {
+			return false
+		}
+	}
+	for _, child := range node.children {
+		if !t.walk(child, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *bkTree) radius(id Identifier, r int) (res []Neighbor) {
+	if t.root == nil {
+		return nil
+	}
+	stack := []*bkNode{t.root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		d := t.metric(node.id, id)
+		if d <= r {
+			for _, e := range node.entries {
+				res = append(res, Neighbor{IndexEntry: e, Distance: d})
+			}
+		}
+		for cd, child := range node.children {
+			if cd >= d-r && cd <= d+r {
+				stack = append(stack, child)
+			}
+		}
+	}
+	return res
+}
+
+func (t *bkTree) nearest(id Identifier, k int, maxDistance int) []Neighbor {
+	s := &knnSearch{metric: t.metric, id: id, k: k, tau: maxDistance}
+	if s.tau < 0 {
+		s.tau = int(^uint(0) >> 1)
+	}
+	s.visit(t.root)
+	return s.res
+}
+
+// knnSearch is a depth first search that shrinks its radius, tau, to the
+// kth best distance seen so far. Entries at tau may still displace the kth
+// on the tie break, they are visited.
+type knnSearch struct {
+	metric Metric
+	id     Identifier
+	k      int
+	tau    int
+	res    []Neighbor // sorted, at most k
+}
+
+func (s *knnSearch) add(n Neighbor) {
+	i := sort.Search(len(s.res), func(i int) bool {
+		return n.less(s.res[i])
+	})
+	if i >= s.k {
+		return
+	}
+	if len(s.res) < s.k {
+		s.res = append(s.res, Neighbor{})
+	}
+	copy(s.res[i+1:], s.res[i:])
+	s.res[i] = n
+	if len(s.res) == s.k {
+		s.tau = s.res[len(s.res)-1].Distance
+	}
+}
+
+func (s *knnSearch) visit(node *bkNode) {
+	if node == nil {
+		return
+	}
+	d := s.metric(node.id, s.id)
+	if d <= s.tau {
+		for _, e := range node.entries {
+			s.add(Neighbor{IndexEntry: e, Distance: d})
+		}
+	}
+
+	// children closest to d are the most likely to tighten tau
+	keys := make([]int, 0, len(node.children))
+	for cd := range node.children {
+		keys = append(keys, cd)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return abs(keys[i]-d) < abs(keys[j]-d)
+	})
+	for _, cd := range keys {
+		if abs(cd-d) > s.tau {
+			break
+		}
+		s.visit(node.children[cd])
+	}
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
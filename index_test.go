@@ -0,0 +1,146 @@
+package HuntingHash
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// randomEntries returns n entries over two prefixes whose voxels differ in a
+// few low bits, so many are at the same distance
+func randomEntries(t *testing.T, r *rand.Rand, n int) []IndexEntry {
+	t.Helper()
+
+	entries := make([]IndexEntry, n)
+	for i := range entries {
+		voxel := make([]byte, 16)
+		for j := range voxel {
+			voxel[j] = byte(r.Intn(4))
+		}
+		id, err := NewIdentifier(6, uint32(1+r.Intn(2)), voxel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// a few buffers share an identifier
+		if i > 0 && r.Intn(8) == 0 {
+			id = entries[r.Intn(i)].Id
+		}
+		entries[i] = IndexEntry{Id: id, Label: fmt.Sprint("file", i), Sha1: fmt.Sprintf("%040x", i)}
+	}
+	return entries
+}
+
+// bruteForce answers radius and nearest queries by scanning every entry
+type bruteForce struct {
+	metric  Metric
+	entries map[[2]string]IndexEntry
+}
+
+func (b *bruteForce) scan(id Identifier, max int) []Neighbor {
+	var res []Neighbor
+	for _, e := range b.entries {
+		if !e.Id.SamePrefix(id) || e.Id.Meta() != id.Meta() {
+			continue
+		}
+		if d := b.metric(e.Id, id); max < 0 || d <= max {
+			res = append(res, Neighbor{IndexEntry: e, Distance: d})
+		}
+	}
+	sortNeighbors(res)
+	return res
+}
+
+func (b *bruteForce) nearest(id Identifier, k, max int) []Neighbor {
+	res := b.scan(id, max)
+	return res[:min(k, len(res))]
+}
+
+func TestIndexMatchesBruteForce(t *testing.T) {
+	for _, metric := range []Metric{HammingDistance, L1Distance} {
+		r := rand.New(rand.NewSource(3))
+		idx := NewSimilarityIndex(metric)
+		brute := &bruteForce{metric: metric, entries: make(map[[2]string]IndexEntry)}
+
+		entries := randomEntries(t, r, 600)
+		for _, e := range entries {
+			idx.Insert(e)
+			brute.entries[[2]string{e.Id.String(), e.Sha1}] = e
+		}
+		// inserting again replaces the entry
+		idx.Insert(entries[0])
+
+		// delete single entries and whole identifiers, enough to rebuild
+		for i := 0; i < 250; i++ {
+			e := entries[r.Intn(len(entries))]
+			sha1 := e.Sha1
+			if i%3 == 0 {
+				sha1 = ""
+			}
+			removed := idx.Delete(e.Id, sha1)
+			want := 0
+			for key, b := range brute.entries {
+				if b.Id == e.Id && (sha1 == "" || b.Sha1 == sha1) {
+					delete(brute.entries, key)
+					want++
+				}
+			}
+			if len(removed) != want {
+				t.Fatalf("delete %s %q removed %d, want %d", e.Id, sha1, len(removed), want)
+			}
+		}
+		if idx.Len() != len(brute.entries) {
+			t.Fatalf("index holds %d entries, want %d", idx.Len(), len(brute.entries))
+		}
+
+		for q := 0; q < 50; q++ {
+			id := randomEntries(t, r, 1)[0].Id
+			for _, radius := range []int{0, 2, 5, 12} {
+				got, want := idx.Radius(id, radius), brute.scan(id, radius)
+				if !sameNeighbors(got, want) {
+					t.Fatalf("radius %d of %s: %d matches, want %d", radius, id, len(got), len(want))
+				}
+			}
+			for _, k := range []int{1, 3, 10, 40} {
+				for _, max := range []int{-1, 0, 4} {
+					got, want := idx.Nearest(id, k, max), brute.nearest(id, k, max)
+					if !sameNeighbors(got, want) {
+						t.Fatalf("%d nearest to %s within %d:\n%v\nwant\n%v", k, id, max, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func sameNeighbors(got, want []Neighbor) bool {
+	return len(got) == len(want) && (len(got) == 0 || reflect.DeepEqual(got, want))
+}
+
+func TestIndexNearestIgnoresInsertionOrder(t *testing.T) {
+	r := rand.New(rand.NewSource(5))
+	entries := randomEntries(t, r, 400)
+
+	first := NewSimilarityIndex(nil)
+	for _, e := range entries {
+		first.Insert(e)
+	}
+	shuffled := NewSimilarityIndex(nil)
+	for _, i := range r.Perm(len(entries)) {
+		shuffled.Insert(entries[i])
+	}
+
+	for q := 0; q < 50; q++ {
+		id := entries[r.Intn(len(entries))].Id
+		for _, k := range []int{1, 5, 25} {
+			a, b := first.Nearest(id, k, -1), shuffled.Nearest(id, k, -1)
+			if !sameNeighbors(a, b) {
+				t.Fatalf("%d nearest to %s depend on the insertion order:\n%v\n%v", k, id, a, b)
+			}
+			if !sort.SliceIsSorted(a, func(i, j int) bool { return a[i].less(a[j]) }) {
+				t.Fatalf("%d nearest to %s are not in order: %v", k, id, a)
+			}
+		}
+	}
+}
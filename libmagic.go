@@ -0,0 +1,116 @@
+//go:build cgo
+
+package HuntingHash
+
+//
+// Copyright 2025 (c) By Rick Wesson & Support Intelligence, Inc.
+// Licenced under the RLL 1.0
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hosom/gomagic"
+)
+
+var errMagicClosed = errors.New("libmagic classifier is closed")
+
+// magicPool holds independent libmagic handles, a handle is only taken for
+// the duration of a lookup so concurrent buffers are only serialised when
+// every handle is in use.
+type magicPool struct {
+	handles   chan *magic.Magic
+	size      atomic.Int64  // handles open
+	closed    chan struct{} // closed by Close, lookups fail from then on
+	closeOnce sync.Once
+
+	lookups   atomic.Uint64
+	waits     atomic.Uint64
+	waitNanos atomic.Int64
+	maxWait   atomic.Int64
+}
+
+// NewLibmagicClassifier opens a pool of libmagic handles, the
+// descriptions depend on the libmagic version and magic database of the host
+func NewLibmagicClassifier(handles int) (TypeClassifier, error) {
+	return newMagicPool(handles)
+}
+
+func newMagicPool(size int) (*magicPool, error) {
+	p := &magicPool{handles: make(chan *magic.Magic, max(size, 1)), closed: make(chan struct{})}
+	for p.size.Load() < int64(cap(p.handles)) {
+		m, err := magic.Open(magic.MAGIC_NONE)
+		if err != nil {
+			p.Close()
+			return nil, fmt.Errorf("error opening libmagic: %w", err)
+		}
+		p.handles <- m
+		p.size.Add(1)
+	}
+	return p, nil
+}
+
+func (p *magicPool) Name() string { return CLASSIFIER_LIBMAGIC }
+
+// Classify describes buffer with the first free handle, it fails once the
+// pool is closed
+func (p *magicPool) Classify(buffer []byte) (string, error) {
+	select {
+	case <-p.closed:
+		return "", errMagicClosed
+	default:
+	}
+	p.lookups.Add(1)
+
+	var m *magic.Magic
+	select {
+	case m = <-p.handles:
+	default:
+		start := time.Now()
+		select {
+		case m = <-p.handles:
+		case <-p.closed:
+			return "", errMagicClosed
+		}
+		wait := int64(time.Since(start))
+		p.waits.Add(1)
+		p.waitNanos.Add(wait)
+		for {
+			prev := p.maxWait.Load()
+			if wait <= prev || p.maxWait.CompareAndSwap(prev, wait) {
+				break
+			}
+		}
+	}
+	defer func() { p.handles <- m }()
+
+	return m.Buffer(buffer)
+}
+
+// Stats reports the use of the handles
+func (p *magicPool) Stats() MagicStats {
+	return MagicStats{
+		Handles:  int(p.size.Load()),
+		Lookups:  p.lookups.Load(),
+		Waits:    p.waits.Load(),
+		WaitTime: time.Duration(p.waitNanos.Load()),
+		MaxWait:  time.Duration(p.maxWait.Load()),
+	}
+}
+
+// Close fails the lookups waiting for a handle, waits for the handles in
+// use to be returned and closes them all
+func (p *magicPool) Close() (err error) {
+	p.closeOnce.Do(func() {
+		close(p.closed)
+		for ; p.size.Load() > 0; p.size.Add(-1) {
+			if cerr := (<-p.handles).Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+	})
+	return err
+}
@@ -0,0 +1,14 @@
+//go:build !cgo
+
+package HuntingHash
+
+//
+// Copyright 2025 (c) By Rick Wesson & Support Intelligence, Inc.
+// Licenced under the RLL 1.0
+
+import "fmt"
+
+// NewLibmagicClassifier needs cgo, without it use the signature classifier
+func NewLibmagicClassifier(handles int) (TypeClassifier, error) {
+	return nil, fmt.Errorf("libmagic is not available in a build without cgo, use the %s classifier", CLASSIFIER_SIGNATURE)
+}
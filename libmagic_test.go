@@ -0,0 +1,70 @@
+//go:build cgo
+
+package HuntingHash
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hosom/gomagic"
+)
+
+func TestMagicPoolClose(t *testing.T) {
+	p, err := newMagicPool(2)
+	if err != nil {
+		t.Skipf("libmagic unavailable: %v", err)
+	}
+	if _, err := p.Classify([]byte("#!/bin/sh\necho hi\n")); err != nil {
+		t.Fatalf("Classify: %v", err)
+	}
+
+	// hold every handle so the next lookup waits for one
+	held := []*magic.Magic{<-p.handles, <-p.handles}
+	waiting := make(chan error, 1)
+	go func() {
+		_, err := p.Classify([]byte("text"))
+		waiting <- err
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for range 100 {
+			p.Stats()
+		}
+	}()
+	closed := make(chan error, 1)
+	go func() {
+		defer wg.Done()
+		closed <- p.Close()
+	}()
+
+	select {
+	case err := <-waiting:
+		if !errors.Is(err, errMagicClosed) {
+			t.Fatalf("waiting Classify = %v, want %v", err, errMagicClosed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiting Classify did not return after Close")
+	}
+	for _, m := range held {
+		p.handles <- m
+	}
+	wg.Wait()
+	if err := <-closed; err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if _, err := p.Classify([]byte("text")); !errors.Is(err, errMagicClosed) {
+		t.Fatalf("Classify after Close = %v, want %v", err, errMagicClosed)
+	}
+	if s := p.Stats(); s.Handles != 0 {
+		t.Fatalf("Stats after Close: %d handles", s.Handles)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+package HuntingHash
+
+//
+// Copyright 2025 (c) By Rick Wesson & Support Intelligence, Inc.
+// Licenced under the RLL 1.0
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// MagicRule rewrites the matches of Pattern with Replace, $1 style
+// references allowed, in descriptions matching Family. A nil Family applies
+// the rule to every description.
+type MagicRule struct {
+	Family  *regexp.Regexp
+	Pattern *regexp.Regexp
+	Replace string
+}
+
+// MagicNormalizer strips the details that vary between builds of the same
+// kind of file, build ids, toolchain versions, timestamps, section counts,
+// from a description before it is hashed into the identifier prefix, so
+// near identical files share a prefix. Rules apply in order, each to the
+// output of the previous one.
+type MagicNormalizer struct {
+	Rules []MagicRule
+}
+
+// defaultMagicRules are the built in rules, family, pattern and replacement
+var defaultMagicRules = [][3]string{
+	// ELF: libmagic appends the build id, the kernel the C library was
+	// built for and the linker's notes
+	{`^ELF `, `, BuildID\[[^\]]*\]=[0-9a-fA-F]+`, ``},
+	{`^ELF `, `, for (GNU/Linux|FreeBSD|NetBSD|OpenBSD|Android) [0-9.]+`, `, for $1`},
+	{`^ELF `, `, with debug_info`, ``},
+	{`^ELF `, `, (not )?stripped$`, ``},
+
+	// PE: the section count changes with the linker and the packer
+	{`^PE32`, `, \d+ sections?`, ``},
+
+	// Mach-O: the flags list the linker options
+	{`^Mach-O`, `, flags:<[^>]*>`, ``},
+
+	// compressed data records the original name, time and size
+	{`^(gzip|bzip2|XZ|Zstandard) compressed`, `, was "[^"]*"`, ``},
+	{`^(gzip|bzip2|XZ|Zstandard) compressed`, `, (last modified|original size modulo 2\^32|original size|from) [^,]*`, ``},
+	{`^(Zip|Java|RAR|7-zip)`, `, (at least v[0-9.]+ to extract|version [0-9.]+|compression method=[^,]*)`, ``},
+
+	// documents: OLE2 properties describe the author, the editing history and
+	// the host, the creating application is kept
+	{`^Composite Document File`, `, (Author|Title|Subject|Keywords|Comments|Template|Last Saved By|Revision Number|Create Time/Date|Last Saved Time/Date|Last Printed|Number of Pages|Number of Words|Number of Characters|Security|Code page|Total Editing Time|Os|Locale ID|Header Length|CLSID): [^,]*`, ``},
+	{`^Composite Document File`, `, Version [0-9.]+`, ``},
+	{`^PDF document`, `, \d+ pages?`, ``},
+
+	// images: dimensions and encoder details
+	{`^(PNG|GIF|JPEG|TIFF|PC bitmap|Web/P) image`, `, \d+ ?x ?\d+`, ``},
+	{`^JPEG image`, `, (JFIF standard [0-9.]+|resolution \([^)]*\)|density \d+x\d+|segment length \d+|precision \d+|components \d+|Exif [^,]*|comment: "[^"]*"|baseline|progressive)`, ``},
+
+	// text: the length of the longest line
+	{`text`, `, with very long lines \(\d+\)`, `, with very long lines`},
+
+	// anywhere: ctime style timestamps
+	{``, `,? ?(created|modified|last modified)?:? ?(Mon|Tue|Wed|Thu|Fri|Sat|Sun) (Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec) +\d+ \d\d:\d\d:\d\d \d{4}`, ``},
+}
+
+// DefaultMagicNormalizer returns the built in rules, per file family
+func DefaultMagicNormalizer() *MagicNormalizer {
+	n := new(MagicNormalizer)
+	for _, r := range defaultMagicRules {
+		if err := n.add(r[0], r[1], r[2]); err != nil {
+			panic(err)
+		}
+	}
+	return n
+}
+
+// Normalize applies the rules to magic, a nil normalizer returns magic as is
+func (n *MagicNormalizer) Normalize(magic string) string {
+	if n == nil {
+		return magic
+	}
+	for _, r := range n.Rules {
+		if r.Family != nil && !r.Family.MatchString(magic) {
+			continue
+		}
+		magic = r.Pattern.ReplaceAllString(magic, r.Replace)
+	}
+	return strings.TrimSpace(magic)
+}
+
+func (n *MagicNormalizer) add(family, pattern, replace string) error {
+	rule := MagicRule{Replace: replace}
+	var err error
+	if family != "" {
+		if rule.Family, err = regexp.Compile(family); err != nil {
+			return fmt.Errorf("family %q: %w", family, err)
+		}
+	}
+	if rule.Pattern, err = regexp.Compile(pattern); err != nil {
+		return fmt.Errorf("pattern %q: %w", pattern, err)
+	}
+	n.Rules = append(n.Rules, rule)
+	return nil
+}
+
+// LoadMagicNormalizer reads a rule file, the rules replace the built in ones
+func LoadMagicNormalizer(filename string) (*MagicNormalizer, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	n, err := ReadMagicNormalizer(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return n, nil
+}
+
+// ReadMagicNormalizer parses rules, one per line:
+//
+//	family <regexp>
+//	<regexp> => <replacement>
+//
+// A family line scopes the rules following it to the descriptions it
+// matches, "family *" lifts the scope. The replacement may be empty and may
+// refer to groups as $1. Blank lines and lines starting with # are ignored.
+func ReadMagicNormalizer(r io.Reader) (*MagicNormalizer, error) {
+	n := new(MagicNormalizer)
+	family := ""
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(text, "family "); ok {
+			family = strings.TrimSpace(rest)
+			if family == "*" {
+				family = ""
+			}
+			if _, err := regexp.Compile(family); err != nil {
+				return nil, fmt.Errorf("line %d: family %q: %w", line, family, err)
+			}
+			continue
+		}
+		pattern, replace, ok := strings.Cut(text, "=>")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected <regexp> => <replacement> or family <regexp>", line)
+		}
+		if err := n.add(family, strings.TrimSpace(pattern), strings.TrimSpace(replace)); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
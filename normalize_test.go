@@ -0,0 +1,115 @@
+package HuntingHash
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDefaultMagicNormalizer(t *testing.T) {
+	n := DefaultMagicNormalizer()
+	for _, tc := range []struct{ magic, want string }{
+		{
+			"ELF 64-bit LSB pie executable, x86-64, version 1 (SYSV), dynamically linked, interpreter /lib64/ld-linux-x86-64.so.2, BuildID[sha1]=36b86f957a1be53733633d184c3a3354f3fc7b12, for GNU/Linux 3.2.0, stripped",
+			"ELF 64-bit LSB pie executable, x86-64, version 1 (SYSV), dynamically linked, interpreter /lib64/ld-linux-x86-64.so.2, for GNU/Linux",
+		},
+		{
+			"ELF 64-bit LSB pie executable, x86-64, version 1 (SYSV), dynamically linked, interpreter /lib64/ld-linux-x86-64.so.2, BuildID[sha1]=0000000000000000000000000000000000000000, for GNU/Linux 4.4.0, with debug_info, not stripped",
+			"ELF 64-bit LSB pie executable, x86-64, version 1 (SYSV), dynamically linked, interpreter /lib64/ld-linux-x86-64.so.2, for GNU/Linux",
+		},
+		{"PE32 executable (GUI) Intel 80386, for MS Windows, 5 sections", "PE32 executable (GUI) Intel 80386, for MS Windows"},
+		{"PE32+ executable (DLL) (console) x86-64, for MS Windows, 1 section", "PE32+ executable (DLL) (console) x86-64, for MS Windows"},
+		{"Mach-O 64-bit arm64 executable, flags:<NOUNDEFS|DYLDLINK|TWOLEVEL|PIE>", "Mach-O 64-bit arm64 executable"},
+		{
+			`gzip compressed data, was "release.tar", last modified: Thu Oct 17 04:13:19 2024, from Unix, original size modulo 2^32 10240`,
+			"gzip compressed data",
+		},
+		{"Zip archive data, at least v2.0 to extract, compression method=deflate", "Zip archive data"},
+		{
+			"Composite Document File V2 Document, Little Endian, Os: Windows, Version 10.0, Code page: 1252, Author: Bob, Template: Normal.dotm, Last Saved By: Alice, Revision Number: 3, Name of Creating Application: Microsoft Office Word, Number of Pages: 1, Security: 0",
+			"Composite Document File V2 Document, Little Endian, Name of Creating Application: Microsoft Office Word",
+		},
+		{"PDF document, version 1.7, 12 pages", "PDF document, version 1.7"},
+		{"PNG image data, 640 x 480, 8-bit/color RGBA, non-interlaced", "PNG image data, 8-bit/color RGBA, non-interlaced"},
+		{"JPEG image data, JFIF standard 1.01, resolution (DPI), density 72x72, segment length 16, baseline, precision 8, 1024x768, components 3", "JPEG image data"},
+		{"ASCII text, with very long lines (4096)", "ASCII text, with very long lines"},
+		// rules only apply to their family
+		{"Python script, ASCII text executable, 5 sections", "Python script, ASCII text executable, 5 sections"},
+		{"data", "data"},
+	} {
+		if got := n.Normalize(tc.magic); got != tc.want {
+			t.Errorf("Normalize(%q)\n = %q\nwant %q", tc.magic, got, tc.want)
+		}
+	}
+
+	var none *MagicNormalizer
+	if got := none.Normalize("ELF 64-bit, stripped"); got != "ELF 64-bit, stripped" {
+		t.Fatalf("a nil normalizer rewrote the magic to %q", got)
+	}
+}
+
+func TestReadMagicNormalizer(t *testing.T) {
+	rules := `
+# comments and blank lines are ignored
+
+, build \d+ =>
+family ^Widget
+(v\d+)\.\d+ => $1
+, serial [0-9a-f]+ =>
+family *
+  trailing$ => end
+`
+	n, err := ReadMagicNormalizer(strings.NewReader(rules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(n.Rules) != 4 {
+		t.Fatalf("%d rules, want 4", len(n.Rules))
+	}
+	for _, tc := range []struct{ magic, want string }{
+		{"Widget v2.17, build 1234, serial 00ff", "Widget v2"},
+		{"Gadget v2.17, build 1234, serial 00ff", "Gadget v2.17, serial 00ff"},
+		{"Widget v3.1 trailing", "Widget v3 end"},
+		{"Gadget trailing", "Gadget end"},
+	} {
+		if got := n.Normalize(tc.magic); got != tc.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tc.magic, got, tc.want)
+		}
+	}
+
+	for _, tc := range []struct{ rules, err string }{
+		{"no arrow here", "line 1: expected"},
+		{"\nfamily (\n", "line 2: family"},
+		{"# ok\n\n[ => x\n", "line 3: pattern"},
+	} {
+		_, err := ReadMagicNormalizer(strings.NewReader(tc.rules))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("rules %q: error %v, want %q", tc.rules, err, tc.err)
+		}
+	}
+}
+
+func TestLoadMagicNormalizer(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "rules")
+	if err := os.WriteFile(file, []byte("family ^ELF\n, stripped$ =>\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	n, err := LoadMagicNormalizer(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := n.Normalize("ELF 32-bit LSB executable, stripped"); got != "ELF 32-bit LSB executable" {
+		t.Fatalf("loaded rules normalize to %q", got)
+	}
+
+	if err := os.WriteFile(file, []byte("bad\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadMagicNormalizer(file); err == nil || !strings.HasPrefix(err.Error(), file+": line 1") {
+		t.Fatalf("error %v does not name the file and line", err)
+	}
+	if _, err := LoadMagicNormalizer(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatal("a missing rule file loaded")
+	}
+}
@@ -0,0 +1,122 @@
+package HuntingHash
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// testHasher is a hasher on a computed order 12 curve with the signature
+// classifier
+func testHasher(t *testing.T) *Hasher {
+	t.Helper()
+
+	curve, err := NewComputedHilbertCurve(12, CURVE_GRAY, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewClassifierHasher(curve, NewSignatureClassifier())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestPyramidLevels(t *testing.T) {
+	h := testHasher(t)
+	buffer := make([]byte, 70000)
+	rand.New(rand.NewSource(13)).Read(buffer)
+	copy(buffer, "\x7fELF\x02\x01\x01")
+
+	plain, err := h.HashBytes(buffer, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain.Id2 != "" || plain.Id8 != "" || plain.Id16 != "" {
+		t.Fatalf("pyramid identifiers without a pyramid: %q %q %q", plain.Id2, plain.Id8, plain.Id16)
+	}
+
+	for _, filter := range []ResampleFilter{FILTER_LANCZOS3, FILTER_BOX} {
+		res, err := h.HashBytesOptions(buffer, "", HashOptions{Pyramid: true, Filter: filter})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if filter == FILTER_LANCZOS3 && res.Id != plain.Id {
+			t.Fatalf("the pyramid changed the identifier: %s, was %s", res.Id, plain.Id)
+		}
+
+		ids, err := res.Identifiers()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ids) != 4 {
+			t.Fatalf("%d identifiers, want 4", len(ids))
+		}
+		_, _, im, err := h.Curve.MapBufferFilter(buffer, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, side := range []int{VOXEL_SIDE, 2, 8, 16} {
+			id := ids[i]
+			if id.Level() != side || id.Filter() != filter {
+				t.Fatalf("identifier %d is level %d filter %s, want %d %s", i, id.Level(), id.Filter(), side, filter)
+			}
+			if id.Order() != int(res.HOrder) || id.MagicHash() != MagicHash(res.NormalizedMagic) {
+				t.Fatalf("%s does not share the prefix of %s", id, res.Id)
+			}
+			want, err := ReduceWith(im, side, filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(id.Voxel(), want) {
+				t.Fatalf("level %d voxel %x, want %x", side, id.Voxel(), want)
+			}
+			// levels are never comparable with one another
+			for _, other := range ids[:i] {
+				if id.SamePrefix(other) {
+					t.Fatalf("%s and %s share a prefix", id, other)
+				}
+			}
+		}
+	}
+}
+
+func TestIndexKeepsLevelsApart(t *testing.T) {
+	h := testHasher(t)
+	h.Pyramid = true
+
+	idx := NewSimilarityIndex(HammingDistance)
+	r := rand.New(rand.NewSource(14))
+	var first []Identifier
+	for i := range 3 {
+		buffer := make([]byte, 20000)
+		r.Read(buffer)
+		res, err := h.HashBytes(buffer, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids, err := res.Identifiers()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, id := range ids {
+			idx.Insert(IndexEntry{Id: id, Sha1: res.Sha1})
+		}
+		if i == 0 {
+			first = ids
+		}
+	}
+
+	for _, id := range first {
+		// every entry of the same level is within the largest distance
+		got := idx.Radius(id, 8*len(id.Voxel()))
+		if len(got) != 3 {
+			t.Fatalf("level %d: %d neighbours, want 3", id.Level(), len(got))
+		}
+		for _, n := range got {
+			if n.Id.Level() != id.Level() {
+				t.Fatalf("searching level %d found %s", id.Level(), n.Id)
+			}
+		}
+	}
+}
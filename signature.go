@@ -0,0 +1,598 @@
+package HuntingHash
+
+//
+// Copyright 2025 (c) By Rick Wesson & Support Intelligence, Inc.
+// Licenced under the RLL 1.0
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// SIGNATURE_SCAN_MAX bounds how much of a buffer the signature classifier
+// searches for archive members and inspects for a text encoding
+const SIGNATURE_SCAN_MAX = 1 << 20
+
+// signatureClassifier describes buffers from their leading signature and a
+// few header fields in pure Go. Its descriptions follow the wording of
+// libmagic but depend only on the buffer, so identifiers built with it are
+// the same on every host.
+type signatureClassifier struct{}
+
+// NewSignatureClassifier returns the pure Go classifier, it needs no cgo and
+// holds no resources
+func NewSignatureClassifier() TypeClassifier {
+	return signatureClassifier{}
+}
+
+func (signatureClassifier) Name() string { return CLASSIFIER_SIGNATURE }
+func (signatureClassifier) Close() error { return nil }
+
+// signatures are tried in order, the first to recognise a buffer describes it
+var signatures = []func(b []byte) string{
+	classifyELF,
+	classifyPE,
+	classifyMachO,
+	classifyArchive,
+	classifyDocument,
+	classifyImage,
+	classifyBinary,
+	classifyScript,
+}
+
+// Classify describes buffer, buffers no signature or text encoding
+// recognises are data
+func (signatureClassifier) Classify(buffer []byte) (string, error) {
+	if len(buffer) == 0 {
+		return "", fmt.Errorf("empty buffer")
+	}
+	for _, classify := range signatures {
+		if desc := classify(buffer); desc != "" {
+			return desc, nil
+		}
+	}
+	if text := textEncoding(buffer); text != "" {
+		return text, nil
+	}
+	return "data", nil
+}
+
+var elfMachines = map[uint16]string{
+	2:      "SPARC",
+	3:      "Intel 80386",
+	8:      "MIPS",
+	20:     "PowerPC",
+	21:     "64-bit PowerPC or cisco 7500",
+	22:     "IBM S/390",
+	40:     "ARM",
+	43:     "SPARC V9",
+	62:     "x86-64",
+	183:    "ARM aarch64",
+	243:    "UCB RISC-V",
+	258:    "LoongArch",
+	0x9026: "Alpha",
+}
+
+var elfABIs = map[byte]string{
+	0:  "SYSV",
+	3:  "GNU/Linux",
+	6:  "Solaris",
+	9:  "FreeBSD",
+	12: "OpenBSD",
+}
+
+func classifyELF(b []byte) string {
+	if len(b) < 52 || !bytes.HasPrefix(b, []byte("\x7fELF")) {
+		return ""
+	}
+	var bits int
+	switch b[4] {
+	case 1:
+		bits = 32
+	case 2:
+		bits = 64
+	default:
+		return "ELF, invalid class"
+	}
+	var order binary.ByteOrder
+	var endian string
+	switch b[5] {
+	case 1:
+		order, endian = binary.LittleEndian, "LSB"
+	case 2:
+		order, endian = binary.BigEndian, "MSB"
+	default:
+		return fmt.Sprintf("ELF %d-bit, invalid byte order", bits)
+	}
+
+	interp, dynamic := elfSegments(b, bits, order)
+	var kind string
+	switch order.Uint16(b[16:]) {
+	case 1:
+		kind = "relocatable"
+	case 2:
+		kind = "executable"
+	case 3:
+		kind = "shared object"
+		if interp {
+			kind = "pie executable"
+		}
+	case 4:
+		kind = "core file"
+	default:
+		kind = "unknown type"
+	}
+
+	desc := fmt.Sprintf("ELF %d-bit %s %s", bits, endian, kind)
+	machine := order.Uint16(b[18:])
+	if name, ok := elfMachines[machine]; ok {
+		desc += ", " + name
+	} else {
+		desc += fmt.Sprintf(", *unknown arch 0x%x*", machine)
+	}
+	abi, ok := elfABIs[b[7]]
+	if !ok {
+		abi = fmt.Sprintf("ABI %d", b[7])
+	}
+	desc += fmt.Sprintf(", version %d (%s)", b[6], abi)
+
+	switch kind {
+	case "executable", "pie executable", "shared object":
+		if dynamic {
+			desc += ", dynamically linked"
+		} else {
+			desc += ", statically linked"
+		}
+	}
+	return desc
+}
+
+// elfSegments reports whether the program headers hold an interpreter and
+// a dynamic section, headers beyond the buffer are ignored
+func elfSegments(b []byte, bits int, order binary.ByteOrder) (interp, dynamic bool) {
+	var phoff uint64
+	var phentsize, phnum int
+	if bits == 32 {
+		phoff = uint64(order.Uint32(b[28:]))
+		phentsize, phnum = int(order.Uint16(b[42:])), int(order.Uint16(b[44:]))
+	} else {
+		if len(b) < 64 {
+			return false, false
+		}
+		phoff = order.Uint64(b[32:])
+		phentsize, phnum = int(order.Uint16(b[54:])), int(order.Uint16(b[56:]))
+	}
+	// phoff comes from the file, bound it before any arithmetic on it
+	if phentsize < 4 || phoff > uint64(len(b)) {
+		return false, false
+	}
+	for i := 0; i < phnum; i++ {
+		off := int(phoff) + i*phentsize
+		if off > len(b)-4 {
+			break
+		}
+		switch order.Uint32(b[off:]) {
+		case 2: // PT_DYNAMIC
+			dynamic = true
+		case 3: // PT_INTERP
+			interp = true
+		}
+	}
+	return interp, dynamic
+}
+
+var peMachines = map[uint16]string{
+	0x014c: "Intel 80386",
+	0x0200: "Intel Itanium",
+	0x01c0: "ARM",
+	0x01c4: "ARMv7 Thumb",
+	0x8664: "x86-64",
+	0xaa64: "Aarch64",
+}
+
+var peSubsystems = map[uint16]string{
+	1:  "native",
+	2:  "GUI",
+	3:  "console",
+	10: "EFI application",
+	11: "EFI boot service driver",
+	12: "EFI runtime driver",
+}
+
+func classifyPE(b []byte) string {
+	if len(b) < 64 || !bytes.HasPrefix(b, []byte("MZ")) {
+		return ""
+	}
+	pe := int(binary.LittleEndian.Uint32(b[0x3c:]))
+	if pe <= 0 || pe > len(b)-24 || !bytes.Equal(b[pe:pe+4], []byte("PE\x00\x00")) {
+		return "MS-DOS executable"
+	}
+	machine := binary.LittleEndian.Uint16(b[pe+4:])
+	optLen := int(binary.LittleEndian.Uint16(b[pe+20:]))
+	characteristics := binary.LittleEndian.Uint16(b[pe+22:])
+	opt := pe + 24
+
+	format, dirs := "PE32", opt+96
+	if opt+2 <= len(b) && binary.LittleEndian.Uint16(b[opt:]) == 0x20b {
+		format, dirs = "PE32+", opt+112
+	}
+	desc := format + " executable"
+	if characteristics&0x2000 != 0 {
+		desc += " (DLL)"
+	}
+	if optLen >= 70 && opt+70 <= len(b) {
+		subsystem := binary.LittleEndian.Uint16(b[opt+68:])
+		if name, ok := peSubsystems[subsystem]; ok {
+			desc += " (" + name + ")"
+		}
+	}
+	if name, ok := peMachines[machine]; ok {
+		desc += " " + name
+	} else {
+		desc += fmt.Sprintf(" Unknown processor type 0x%x", machine)
+	}
+	// the CLR runtime header is the 15th data directory
+	clr := dirs + 14*8
+	if clr+8 <= opt+optLen && clr+8 <= len(b) && binary.LittleEndian.Uint32(b[clr:]) != 0 {
+		desc += " Mono/.Net assembly"
+	}
+	return desc + ", for MS Windows"
+}
+
+var machoCPUs = map[uint32]string{
+	7:          "i386",
+	0x01000007: "x86_64",
+	12:         "arm",
+	0x0100000c: "arm64",
+	18:         "ppc",
+	0x01000012: "ppc64",
+}
+
+var machoTypes = map[uint32]string{
+	1:  "object",
+	2:  "executable",
+	6:  "dynamically linked shared library",
+	7:  "dynamic linker",
+	8:  "bundle",
+	9:  "dynamically linked shared library stub",
+	10: "dSYM companion file",
+	11: "kext bundle",
+}
+
+func classifyMachO(b []byte) string {
+	if len(b) < 16 {
+		return ""
+	}
+	var order binary.ByteOrder
+	var bits int
+	switch binary.BigEndian.Uint32(b) {
+	case 0xcafebabe:
+		// fat binaries and java classes share a magic, java versions
+		// start at 45 where fat binaries count a few architectures
+		n := binary.BigEndian.Uint32(b[4:])
+		if n < 20 {
+			return fmt.Sprintf("Mach-O universal binary with %d architectures", n)
+		}
+		return fmt.Sprintf("compiled Java class data, version %d.%d",
+			binary.BigEndian.Uint16(b[6:]), binary.BigEndian.Uint16(b[4:]))
+	case 0xfeedface:
+		order, bits = binary.BigEndian, 32
+	case 0xfeedfacf:
+		order, bits = binary.BigEndian, 64
+	case 0xcefaedfe:
+		order, bits = binary.LittleEndian, 32
+	case 0xcffaedfe:
+		order, bits = binary.LittleEndian, 64
+	default:
+		return ""
+	}
+	desc := "Mach-O"
+	if bits == 64 {
+		desc += " 64-bit"
+	}
+	cpu := order.Uint32(b[4:])
+	if name, ok := machoCPUs[cpu]; ok {
+		desc += " " + name
+	} else {
+		desc += fmt.Sprintf(" cpu 0x%x", cpu)
+	}
+	if kind, ok := machoTypes[order.Uint32(b[12:])]; ok {
+		desc += " " + kind
+	}
+	return desc
+}
+
+func classifyArchive(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, []byte("PK\x03\x04")):
+		return classifyZip(b)
+	case bytes.HasPrefix(b, []byte("\x1f\x8b")):
+		return "gzip compressed data"
+	case bytes.HasPrefix(b, []byte("BZh")) && len(b) > 3 && b[3] >= '1' && b[3] <= '9':
+		return fmt.Sprintf("bzip2 compressed data, block size = %dk", int(b[3]-'0')*100)
+	case bytes.HasPrefix(b, []byte("\xfd7zXZ\x00")):
+		return "XZ compressed data"
+	case bytes.HasPrefix(b, []byte("\x28\xb5\x2f\xfd")):
+		return "Zstandard compressed data"
+	case bytes.HasPrefix(b, []byte("7z\xbc\xaf\x27\x1c")) && len(b) > 7:
+		return fmt.Sprintf("7-zip archive data, version %d.%d", b[6], b[7])
+	case bytes.HasPrefix(b, []byte("Rar!\x1a\x07\x01\x00")):
+		return "RAR archive data, v5"
+	case bytes.HasPrefix(b, []byte("Rar!\x1a\x07\x00")):
+		return "RAR archive data, v4"
+	case bytes.HasPrefix(b, []byte("MSCF\x00\x00\x00\x00")):
+		return "Microsoft Cabinet archive data"
+	case bytes.HasPrefix(b, []byte("\xed\xab\xee\xdb")):
+		return "RPM"
+	case bytes.HasPrefix(b, []byte("!<arch>\n")):
+		if bytes.HasPrefix(b[8:], []byte("debian-binary")) {
+			return "Debian binary package"
+		}
+		return "current ar archive"
+	case len(b) > 265 && bytes.Equal(b[257:265], []byte("ustar  \x00")):
+		return "POSIX tar archive (GNU)"
+	case len(b) > 262 && bytes.Equal(b[257:262], []byte("ustar")):
+		return "POSIX tar archive"
+	}
+	return ""
+}
+
+// classifyZip tells the formats built on zip apart by their members
+func classifyZip(b []byte) string {
+	// OpenDocument and EPUB store their mime type first and uncompressed
+	if len(b) >= 30 {
+		nameLen := int(binary.LittleEndian.Uint16(b[26:]))
+		extraLen := int(binary.LittleEndian.Uint16(b[28:]))
+		if 30+nameLen <= len(b) && string(b[30:30+nameLen]) == "mimetype" {
+			data := b[min(30+nameLen+extraLen, len(b)):]
+			switch {
+			case bytes.HasPrefix(data, []byte("application/epub+zip")):
+				return "EPUB document"
+			case bytes.HasPrefix(data, []byte("application/vnd.oasis.opendocument.text")):
+				return "OpenDocument Text"
+			case bytes.HasPrefix(data, []byte("application/vnd.oasis.opendocument.spreadsheet")):
+				return "OpenDocument Spreadsheet"
+			case bytes.HasPrefix(data, []byte("application/vnd.oasis.opendocument.presentation")):
+				return "OpenDocument Presentation"
+			}
+		}
+	}
+
+	scan := b[:min(len(b), SIGNATURE_SCAN_MAX)]
+	has := func(name string) bool { return bytes.Contains(scan, []byte(name)) }
+	switch {
+	case has("[Content_Types].xml") && has("word/"):
+		return "Microsoft Word 2007+"
+	case has("[Content_Types].xml") && has("xl/"):
+		return "Microsoft Excel 2007+"
+	case has("[Content_Types].xml") && has("ppt/"):
+		return "Microsoft PowerPoint 2007+"
+	case has("AndroidManifest.xml") && has("classes.dex"):
+		return "Android package (APK)"
+	case has("META-INF/MANIFEST.MF"):
+		return "Java archive data (JAR)"
+	}
+	return "Zip archive data"
+}
+
+// utf16 encodes an ASCII name the way OLE2 directory entries store it
+func utf16(name string) []byte {
+	b := make([]byte, 0, 2*len(name))
+	for i := 0; i < len(name); i++ {
+		b = append(b, name[i], 0)
+	}
+	return b
+}
+
+func classifyDocument(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, []byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1")):
+		scan := b[:min(len(b), SIGNATURE_SCAN_MAX)]
+		desc := "Composite Document File V2 Document"
+		switch {
+		case bytes.Contains(scan, utf16("WordDocument")):
+			desc += ", Microsoft Word"
+		case bytes.Contains(scan, utf16("Workbook")), bytes.Contains(scan, utf16("Book")):
+			desc += ", Microsoft Excel"
+		case bytes.Contains(scan, utf16("PowerPoint Document")):
+			desc += ", Microsoft PowerPoint"
+		}
+		return desc
+	case bytes.HasPrefix(b, []byte("%PDF-")):
+		version := b[5:]
+		n := 0
+		for n < len(version) && n < 8 && (version[n] == '.' || version[n] >= '0' && version[n] <= '9') {
+			n++
+		}
+		return "PDF document, version " + string(version[:n])
+	case bytes.HasPrefix(b, []byte("{\\rtf1")):
+		return "Rich Text Format data"
+	case bytes.HasPrefix(b, []byte("%!PS")):
+		return "PostScript document text"
+	case bytes.HasPrefix(b, []byte("SQLite format 3\x00")):
+		return "SQLite 3.x database"
+	}
+	return ""
+}
+
+func classifyImage(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, []byte("\x89PNG\r\n\x1a\n")) && len(b) >= 24:
+		return fmt.Sprintf("PNG image data, %d x %d",
+			binary.BigEndian.Uint32(b[16:]), binary.BigEndian.Uint32(b[20:]))
+	case bytes.HasPrefix(b, []byte("\xff\xd8\xff")):
+		return "JPEG image data"
+	case (bytes.HasPrefix(b, []byte("GIF87a")) || bytes.HasPrefix(b, []byte("GIF89a"))) && len(b) >= 10:
+		return fmt.Sprintf("GIF image data, version %s, %d x %d", b[3:6],
+			binary.LittleEndian.Uint16(b[6:]), binary.LittleEndian.Uint16(b[8:]))
+	}
+	return ""
+}
+
+func classifyBinary(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, []byte("dex\n")) && len(b) >= 8:
+		return fmt.Sprintf("Dalvik dex file version %s", bytes.TrimRight(b[4:7], "\x00"))
+	case bytes.HasPrefix(b, []byte("\x00asm")) && len(b) >= 8:
+		return fmt.Sprintf("WebAssembly (wasm) binary module version 0x%x", binary.LittleEndian.Uint32(b[4:]))
+	}
+	return ""
+}
+
+var interpreters = map[string]string{
+	"sh":      "POSIX shell script",
+	"dash":    "POSIX shell script",
+	"bash":    "Bourne-Again shell script",
+	"zsh":     "Paul Falstad's zsh script",
+	"ksh":     "Korn shell script",
+	"csh":     "C shell script",
+	"tcsh":    "Tenex C shell script",
+	"perl":    "Perl script",
+	"python":  "Python script",
+	"python2": "Python script",
+	"python3": "Python script",
+	"ruby":    "Ruby script",
+	"node":    "Node.js script",
+	"php":     "PHP script",
+	"lua":     "Lua script",
+	"awk":     "awk script",
+	"tclsh":   "Tcl script",
+}
+
+// classifyScript recognises scripts by their interpreter line and the
+// markup languages by their opening tag, the text encoding follows
+func classifyScript(b []byte) string {
+	var desc, suffix string
+	switch {
+	case bytes.HasPrefix(b, []byte("#!")):
+		desc, suffix = interpreter(b), " executable"
+	case bytes.HasPrefix(b, []byte("<?php")):
+		desc = "PHP script"
+	case bytes.HasPrefix(b, []byte("<?xml")):
+		desc = "XML 1.0 document"
+	default:
+		lead := bytes.ToLower(bytes.TrimLeft(b[:min(len(b), 256)], " \t\r\n"))
+		if bytes.HasPrefix(lead, []byte("<!doctype html")) || bytes.HasPrefix(lead, []byte("<html")) {
+			desc = "HTML document"
+		}
+	}
+	if desc == "" {
+		return ""
+	}
+	text := textEncoding(b)
+	if text == "" {
+		return desc + ", data"
+	}
+	return desc + ", " + text + suffix
+}
+
+// interpreter names the script run by the #! line opening b
+func interpreter(b []byte) string {
+	line := b[2:]
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 {
+		return "a script"
+	}
+	name := path.Base(fields[0])
+	if name == "env" {
+		name = ""
+		for _, f := range fields[1:] {
+			if !strings.HasPrefix(f, "-") && !strings.Contains(f, "=") {
+				name = path.Base(f)
+				break
+			}
+		}
+	}
+	if desc, ok := interpreters[name]; ok {
+		return desc
+	}
+	if strings.HasPrefix(name, "python") {
+		return "Python script"
+	}
+	if name == "" {
+		return "a script"
+	}
+	return "a " + name + " script"
+}
+
+// textEncoding names the encoding of text, it is empty for binary data. Only
+// the first SIGNATURE_SCAN_MAX bytes are inspected.
+func textEncoding(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, []byte("\xef\xbb\xbf")):
+		if isUTF8Text(b[3:]) {
+			return "Unicode text, UTF-8 (with BOM) text"
+		}
+		return ""
+	case bytes.HasPrefix(b, []byte("\xff\xfe")):
+		return "Unicode text, UTF-16, little-endian text"
+	case bytes.HasPrefix(b, []byte("\xfe\xff")):
+		return "Unicode text, UTF-16, big-endian text"
+	}
+
+	ascii, latin := true, true
+	for _, c := range b[:min(len(b), SIGNATURE_SCAN_MAX)] {
+		switch {
+		case isTextByte(c):
+		case c >= 0xa0:
+			ascii = false
+		case c >= 0x80:
+			ascii, latin = false, false
+		default:
+			return ""
+		}
+	}
+	switch {
+	case ascii:
+		return "ASCII text"
+	case isUTF8Text(b):
+		return "Unicode text, UTF-8 text"
+	case latin:
+		return "ISO-8859 text"
+	}
+	return "Non-ISO extended-ASCII text"
+}
+
+// isTextByte reports whether c is printable ASCII or common white space
+func isTextByte(c byte) bool {
+	return c >= 0x20 && c < 0x7f || c >= 0x07 && c <= 0x0d || c == 0x1b
+}
+
+// isUTF8Text reports whether b is valid UTF-8 without control characters, a
+// rune cut off by the scan limit is forgiven
+func isUTF8Text(b []byte) bool {
+	if len(b) > SIGNATURE_SCAN_MAX {
+		b = b[:SIGNATURE_SCAN_MAX]
+		if r, size := utf8.DecodeLastRune(b); r == utf8.RuneError && size == 1 {
+			b = trimPartialRune(b)
+		}
+	}
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		if r == utf8.RuneError && size <= 1 {
+			return false
+		}
+		if r < 0x80 && !isTextByte(byte(r)) {
+			return false
+		}
+		b = b[size:]
+	}
+	return true
+}
+
+// trimPartialRune drops the start of a multi byte rune ending b
+func trimPartialRune(b []byte) []byte {
+	for i := 1; i < utf8.UTFMax && i <= len(b); i++ {
+		if utf8.RuneStart(b[len(b)-i]) {
+			return b[:len(b)-i]
+		}
+	}
+	return b
+}
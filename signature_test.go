@@ -0,0 +1,197 @@
+package HuntingHash
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// elf64 builds a little-endian 64-bit ELF header of type typ for machine
+// followed by one program header of each segment type
+func elf64(typ, machine uint16, segments ...uint32) []byte {
+	b := make([]byte, 64+56*len(segments))
+	copy(b, "\x7fELF\x02\x01\x01\x03")
+	le := binary.LittleEndian
+	le.PutUint16(b[16:], typ)
+	le.PutUint16(b[18:], machine)
+	le.PutUint64(b[32:], 64) // phoff
+	le.PutUint16(b[54:], 56) // phentsize
+	le.PutUint16(b[56:], uint16(len(segments)))
+	for i, s := range segments {
+		le.PutUint32(b[64+56*i:], s)
+	}
+	return b
+}
+
+// pe builds a PE32+ header, dll and clr set the DLL characteristic and the
+// CLR runtime directory
+func pe(machine, subsystem uint16, dll, clr bool) []byte {
+	const off, optLen = 0x80, 240
+	b := make([]byte, off+24+optLen)
+	le := binary.LittleEndian
+	copy(b, "MZ")
+	le.PutUint32(b[0x3c:], off)
+	copy(b[off:], "PE\x00\x00")
+	le.PutUint16(b[off+4:], machine)
+	le.PutUint16(b[off+20:], optLen)
+	if dll {
+		le.PutUint16(b[off+22:], 0x2000)
+	}
+	opt := off + 24
+	le.PutUint16(b[opt:], 0x20b)
+	le.PutUint16(b[opt+68:], subsystem)
+	if clr {
+		le.PutUint32(b[opt+112+14*8:], 0x2000)
+	}
+	return b
+}
+
+// zipOf builds a zip archive holding the named members, stored uncompressed
+func zipOf(t *testing.T, members ...string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range members {
+		f, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name == "mimetype" {
+			f.Write([]byte("application/vnd.oasis.opendocument.text"))
+		} else {
+			f.Write([]byte("member"))
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSignatureClassifier(t *testing.T) {
+	le32 := func(v ...uint32) []byte {
+		b := make([]byte, 4*len(v))
+		for i, x := range v {
+			binary.LittleEndian.PutUint32(b[4*i:], x)
+		}
+		return b
+	}
+	be32 := func(v ...uint32) []byte {
+		b := make([]byte, 4*len(v))
+		for i, x := range v {
+			binary.BigEndian.PutUint32(b[4*i:], x)
+		}
+		return b
+	}
+
+	for _, tc := range []struct {
+		name   string
+		buffer []byte
+		want   string
+	}{
+		{"elf pie", elf64(3, 62, 6, 3, 1, 2), "ELF 64-bit LSB pie executable, x86-64, version 1 (GNU/Linux), dynamically linked"},
+		{"elf shared object", elf64(3, 183, 1, 2), "ELF 64-bit LSB shared object, ARM aarch64, version 1 (GNU/Linux), dynamically linked"},
+		{"elf static", elf64(2, 243, 1), "ELF 64-bit LSB executable, UCB RISC-V, version 1 (GNU/Linux), statically linked"},
+		{"elf relocatable", elf64(1, 62), "ELF 64-bit LSB relocatable, x86-64, version 1 (GNU/Linux)"},
+		{"elf unknown arch", elf64(4, 0x1234), "ELF 64-bit LSB core file, *unknown arch 0x1234*, version 1 (GNU/Linux)"},
+		{"pe console", pe(0x8664, 3, false, false), "PE32+ executable (console) x86-64, for MS Windows"},
+		{"pe dll", pe(0xaa64, 2, true, false), "PE32+ executable (DLL) (GUI) Aarch64, for MS Windows"},
+		{"pe .net", pe(0x8664, 3, false, true), "PE32+ executable (console) x86-64 Mono/.Net assembly, for MS Windows"},
+		{"ms-dos", append([]byte("MZ"), make([]byte, 100)...), "MS-DOS executable"},
+		{"mach-o", le32(0xfeedfacf, 0x0100000c, 0, 2), "Mach-O 64-bit arm64 executable"},
+		{"mach-o dylib", le32(0xfeedface, 7, 3, 6), "Mach-O i386 dynamically linked shared library"},
+		{"mach-o universal", be32(0xcafebabe, 2, 0, 0), "Mach-O universal binary with 2 architectures"},
+		{"java class", be32(0xcafebabe, 52, 0, 0), "compiled Java class data, version 52.0"},
+		{"zip", zipOf(t, "a.txt", "b.txt"), "Zip archive data"},
+		{"docx", zipOf(t, "[Content_Types].xml", "word/document.xml"), "Microsoft Word 2007+"},
+		{"xlsx", zipOf(t, "[Content_Types].xml", "xl/workbook.xml"), "Microsoft Excel 2007+"},
+		{"jar", zipOf(t, "META-INF/MANIFEST.MF", "Main.class"), "Java archive data (JAR)"},
+		{"apk", zipOf(t, "AndroidManifest.xml", "classes.dex"), "Android package (APK)"},
+		{"odt", zipOf(t, "mimetype", "content.xml"), "OpenDocument Text"},
+		{"sh", []byte("#!/bin/sh\necho hello\n"), "POSIX shell script, ASCII text executable"},
+		{"bash", []byte("#! /bin/bash -e\nset -u\n"), "Bourne-Again shell script, ASCII text executable"},
+		{"env python", []byte("#!/usr/bin/env python3\nprint('hi')\n"), "Python script, ASCII text executable"},
+		{"env flags", []byte("#!/usr/bin/env -S LC_ALL=C perl -w\n"), "Perl script, ASCII text executable"},
+		{"versioned python", []byte("#!/usr/local/bin/python3.12\n"), "Python script, ASCII text executable"},
+		{"unknown interpreter", []byte("#!/opt/bin/frob\n"), "a frob script, ASCII text executable"},
+		{"utf-8 script", []byte("#!/bin/sh\necho héllo\n"), "POSIX shell script, Unicode text, UTF-8 text executable"},
+		{"binary script", []byte("#!/bin/sh\n\x00\x01"), "POSIX shell script, data"},
+		{"php", []byte("<?php echo 1; ?>\n"), "PHP script, ASCII text"},
+		{"html", []byte("\n  <!DOCTYPE html>\n<html></html>\n"), "HTML document, ASCII text"},
+		{"ascii", []byte("plain text\n"), "ASCII text"},
+		{"utf-8", []byte("naïve text\n"), "Unicode text, UTF-8 text"},
+		{"bom", []byte("\xef\xbb\xbfbom text\n"), "Unicode text, UTF-8 (with BOM) text"},
+		{"latin-1", []byte("na\xefve text\n"), "ISO-8859 text"},
+		{"data", []byte{0, 1, 2, 3, 4, 5}, "data"},
+	} {
+		got, err := NewSignatureClassifier().Classify(tc.buffer)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got != tc.want {
+			t.Errorf("%s: %q, want %q", tc.name, got, tc.want)
+		}
+	}
+
+	if _, err := NewSignatureClassifier().Classify(nil); err == nil {
+		t.Fatal("an empty buffer was classified")
+	}
+}
+
+func TestSignatureClassifierTruncatedHeaders(t *testing.T) {
+	c := NewSignatureClassifier()
+	for _, full := range [][]byte{
+		elf64(3, 62, 6, 3, 1, 2),
+		pe(0x8664, 3, true, true),
+		{0xcf, 0xfa, 0xed, 0xfe, 0x0c, 0, 0, 1, 0, 0, 0, 0, 2, 0, 0, 0},
+	} {
+		// every prefix is described without reading past it
+		for n := 1; n <= len(full); n++ {
+			if _, err := c.Classify(full[:n]); err != nil {
+				t.Fatalf("%d bytes: %v", n, err)
+			}
+		}
+	}
+}
+
+func TestSignatureClassifierMalformedHeaders(t *testing.T) {
+	le := binary.LittleEndian
+	for name, corrupt := range map[string]func(b []byte){
+		"phoff near the top": func(b []byte) {
+			le.PutUint64(b[32:], 0xfffffffffffffffe)
+			le.PutUint16(b[54:], 4)
+		},
+		"phoff past the end": func(b []byte) { le.PutUint64(b[32:], 1<<40) },
+		"phoff at the end":   func(b []byte) { le.PutUint64(b[32:], uint64(len(b))) },
+		"huge header table": func(b []byte) {
+			le.PutUint16(b[54:], 0xffff)
+			le.PutUint16(b[56:], 0xffff)
+		},
+	} {
+		b := elf64(3, 62, 3, 2)[:128]
+		corrupt(b)
+		if _, err := NewSignatureClassifier().Classify(b); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+
+	b := pe(0x8664, 3, false, false)
+	le.PutUint32(b[0x3c:], 0xfffffff0)
+	if _, err := NewSignatureClassifier().Classify(b); err != nil {
+		t.Fatalf("PE offset near the top: %v", err)
+	}
+}
+
+func FuzzSignatureClassifier(f *testing.F) {
+	f.Add(elf64(3, 62, 6, 3, 1, 2))
+	f.Add(pe(0x8664, 3, true, true))
+	f.Add([]byte{0xcf, 0xfa, 0xed, 0xfe, 0x0c, 0, 0, 1, 0, 0, 0, 0, 2, 0, 0, 0})
+	f.Add([]byte("#!/bin/sh\necho hello\n"))
+	c := NewSignatureClassifier()
+	f.Fuzz(func(t *testing.T, b []byte) {
+		// a panic fails the fuzz target, the description itself is free
+		c.Classify(b)
+	})
+}
@@ -0,0 +1,592 @@
+package HuntingHash
+
+//
+// Copyright 2025 (c) By Rick Wesson & Support Intelligence, Inc.
+// Licenced under the RLL 1.0
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	STORE_SNAPSHOT      = "snapshot"
+	STORE_WAL_PREFIX    = "wal."
+	STORE_COMPACT_AFTER = 100000 // write ahead log records before an automatic compaction
+	STORE_MAX_FRAME     = 64 << 20
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// StoreRecord is everything the store knows about a buffer, keyed by SHA-1
+type StoreRecord struct {
+	Sha1            string
+	Id              string
+	Label           string
+	Magic           string
+	Len             int32
+	Ssdeep          string
+	Tlsh            string
+	Sdhash          string
+	Id2             string `json:",omitempty"` // identifier pyramid, when it was computed
+	Id8             string `json:",omitempty"`
+	Id16            string `json:",omitempty"`
+	NormalizedMagic string `json:",omitempty"` // hashed into the prefix, when it differs from Magic
+	Indexed         bool   // the record is part of the similarity index
+	FirstSeen       time.Time
+	LastSeen        time.Time
+}
+
+// NewStoreRecord builds the record for a hashing result seen at now
+func NewStoreRecord(res *Result, now time.Time) StoreRecord {
+	rec := StoreRecord{
+		Sha1:      res.Sha1,
+		Id:        res.Id,
+		Label:     res.Label,
+		Magic:     res.Magic,
+		Len:       res.Len,
+		Ssdeep:    res.Ssdeep,
+		Tlsh:      res.Tlsh,
+		Sdhash:    res.Sdhash,
+		Id2:       res.Id2,
+		Id8:       res.Id8,
+		Id16:      res.Id16,
+		FirstSeen: now,
+		LastSeen:  now,
+	}
+	if res.NormalizedMagic != res.Magic {
+		rec.NormalizedMagic = res.NormalizedMagic
+	}
+	return rec
+}
+
+// Identifiers parses the identifier and, when there is one, the pyramid
+func (rec *StoreRecord) Identifiers() ([]Identifier, error) {
+	return parseIdentifiers(rec.Id, rec.Id2, rec.Id8, rec.Id16)
+}
+
+// merge folds a newer sighting of the same buffer into rec. The identifiers
+// of an indexed record are those in the similarity index, a sighting that
+// is not indexed, perhaps hashed with another filter, does not replace them.
+func (rec *StoreRecord) merge(newer StoreRecord) {
+	if rec.FirstSeen.IsZero() || (!newer.FirstSeen.IsZero() && newer.FirstSeen.Before(rec.FirstSeen)) {
+		rec.FirstSeen = newer.FirstSeen
+	}
+	if newer.LastSeen.After(rec.LastSeen) {
+		rec.LastSeen = newer.LastSeen
+	}
+	fields := []struct{ dst, src *string }{
+		{&rec.Label, &newer.Label},
+		{&rec.Ssdeep, &newer.Ssdeep},
+		{&rec.Tlsh, &newer.Tlsh},
+		{&rec.Sdhash, &newer.Sdhash},
+	}
+	if (!rec.Indexed || newer.Indexed) && len(newer.Id) > 0 {
+		if newer.Id != rec.Id {
+			// a new identifier, the pyramid of the old one goes with it
+			rec.Id2, rec.Id8, rec.Id16 = "", "", ""
+		}
+		// an empty NormalizedMagic is the same as Magic, they go together
+		rec.Id, rec.Magic, rec.NormalizedMagic = newer.Id, newer.Magic, newer.NormalizedMagic
+		fields = append(fields, []struct{ dst, src *string }{
+			{&rec.Id2, &newer.Id2},
+			{&rec.Id8, &newer.Id8},
+			{&rec.Id16, &newer.Id16},
+		}...)
+	}
+	for _, f := range fields {
+		if len(*f.src) > 0 {
+			*f.dst = *f.src
+		}
+	}
+	if newer.Len > 0 {
+		rec.Len = newer.Len
+	}
+	rec.Indexed = rec.Indexed || newer.Indexed
+}
+
+// walEntry is a write ahead log record, it carries the full state of the
+// record after the operation so replaying the log is idempotent.
+type walEntry struct {
+	Op     string       `json:"op"` // put or del
+	Sha1   string       `json:"sha1,omitempty"`
+	Record *StoreRecord `json:"rec,omitempty"`
+}
+
+type snapshotHeader struct {
+	Gen   uint64 `json:"gen"` // write ahead logs up to and including gen are in the snapshot
+	Count int    `json:"count"`
+}
+
+// Store is an embedded, crash safe record store. Every change is appended to
+// a write ahead log, compaction starts a new log and writes the records to a
+// snapshot file. On open the snapshot is loaded and newer logs replayed.
+type Store struct {
+	SyncWrites   bool // fsync the write ahead log after every change
+	CompactAfter int  // compact in the background once the log holds this many records, 0 disables
+
+	mu         sync.RWMutex
+	dir        string
+	gen        uint64
+	wal        *os.File
+	walRecords int
+	records    map[string]*StoreRecord // records are replaced, never modified in place
+	compacting bool                    // a background compaction is running
+	compactErr error                   // of the last background compaction
+	background sync.WaitGroup
+
+	snapMu  sync.Mutex // serialises writing snapshots
+	snapGen uint64     // generation of the snapshot on disk
+}
+
+// storeSnapshot is the state of the store when a write ahead log was closed
+type storeSnapshot struct {
+	gen     uint64 // the logs up to and including gen are in the snapshot
+	records []*StoreRecord
+}
+
+// OpenStore opens, or creates, the store in dir
+func OpenStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating store directory: %w", err)
+	}
+	s := &Store{
+		SyncWrites:   true,
+		CompactAfter: STORE_COMPACT_AFTER,
+		dir:          dir,
+		records:      make(map[string]*StoreRecord),
+	}
+
+	snapGen, err := s.loadSnapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	gens, err := s.walGenerations()
+	if err != nil {
+		return nil, err
+	}
+	s.snapGen = snapGen
+	s.gen = snapGen + 1
+	for i, g := range gens {
+		if g <= snapGen {
+			// already folded into the snapshot, left over from a compaction
+			os.Remove(s.walName(g))
+			continue
+		}
+		if err := s.replay(g, i == len(gens)-1); err != nil {
+			return nil, err
+		}
+		s.gen = g
+	}
+
+	s.wal, err = os.OpenFile(s.walName(s.gen), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening write ahead log: %w", err)
+	}
+	return s, syncDir(dir)
+}
+
+func (s *Store) walName(gen uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s%016d", STORE_WAL_PREFIX, gen))
+}
+
+func (s *Store) walGenerations() (gens []uint64, err error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading store directory: %w", err)
+	}
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), STORE_WAL_PREFIX) {
+			continue
+		}
+		g, err := strconv.ParseUint(strings.TrimPrefix(e.Name(), STORE_WAL_PREFIX), 10, 64)
+		if err != nil {
+			continue
+		}
+		gens = append(gens, g)
+	}
+	sort.Slice(gens, func(i, j int) bool { return gens[i] < gens[j] })
+	return gens, nil
+}
+
+func (s *Store) loadSnapshot() (uint64, error) {
+	file, err := os.Open(filepath.Join(s.dir, STORE_SNAPSHOT))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error opening snapshot: %w", err)
+	}
+	defer file.Close()
+	r := bufio.NewReader(file)
+
+	var hdr snapshotHeader
+	payload, err := readFrame(r)
+	if err != nil {
+		return 0, fmt.Errorf("error reading snapshot header: %w", err)
+	}
+	if err := json.Unmarshal(payload, &hdr); err != nil {
+		return 0, fmt.Errorf("error decoding snapshot header: %w", err)
+	}
+
+	for i := 0; i < hdr.Count; i++ {
+		payload, err := readFrame(r)
+		if err != nil {
+			return 0, fmt.Errorf("snapshot is corrupt after %d of %d records: %w", i, hdr.Count, err)
+		}
+		rec := new(StoreRecord)
+		if err := json.Unmarshal(payload, rec); err != nil {
+			return 0, fmt.Errorf("error decoding snapshot record: %w", err)
+		}
+		s.records[rec.Sha1] = rec
+	}
+	return hdr.Gen, nil
+}
+
+// replay applies a write ahead log. A torn record at the end of the last
+// log is the trace of a crash and is cut off, anywhere else it is an error.
+func (s *Store) replay(gen uint64, last bool) error {
+	name := s.walName(gen)
+	file, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("error opening write ahead log: %w", err)
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	var good int64
+	for {
+		payload, err := readFrame(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if !last {
+				return fmt.Errorf("write ahead log %s is corrupt at offset %d: %w", name, good, err)
+			}
+			if err := file.Truncate(good); err != nil {
+				return fmt.Errorf("error truncating write ahead log: %w", err)
+			}
+			return file.Sync()
+		}
+		var e walEntry
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return fmt.Errorf("error decoding write ahead log record: %w", err)
+		}
+		s.apply(e)
+		s.walRecords++
+		good += int64(8 + len(payload))
+	}
+}
+
+func (s *Store) apply(e walEntry) {
+	switch e.Op {
+	case "put":
+		if e.Record != nil {
+			rec := *e.Record
+			s.records[rec.Sha1] = &rec
+		}
+	case "del":
+		delete(s.records, e.Sha1)
+	}
+}
+
+// append logs e and applies it, the caller holds the write lock
+func (s *Store) append(e walEntry) error {
+	if s.wal == nil {
+		return fmt.Errorf("store is closed")
+	}
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := s.wal.Write(frame(payload)); err != nil {
+		return fmt.Errorf("error writing write ahead log: %w", err)
+	}
+	if s.SyncWrites {
+		if err := s.wal.Sync(); err != nil {
+			return fmt.Errorf("error syncing write ahead log: %w", err)
+		}
+	}
+	s.apply(e)
+	s.walRecords++
+
+	if s.CompactAfter > 0 && s.walRecords >= s.CompactAfter && !s.compacting {
+		snap, err := s.rotate(true)
+		if err != nil {
+			return err
+		}
+		s.compacting = true
+		s.background.Add(1)
+		go func() {
+			defer s.background.Done()
+			err := s.writeSnapshot(snap)
+
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.compacting = false
+			s.compactErr = err
+		}()
+	}
+	return nil
+}
+
+// Put records a sighting of a buffer and returns the merged record
+func (s *Store) Put(rec StoreRecord) (StoreRecord, error) {
+	if len(rec.Sha1) == 0 {
+		return rec, fmt.Errorf("record has no sha1")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	merged := rec
+	if old, ok := s.records[rec.Sha1]; ok {
+		merged = *old
+		merged.merge(rec)
+	}
+	if err := s.append(walEntry{Op: "put", Record: &merged}); err != nil {
+		return rec, err
+	}
+	return merged, nil
+}
+
+// SetIndexed marks the record as part of the similarity index, or not
+func (s *Store) SetIndexed(sha1 string, indexed bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok := s.records[sha1]
+	if !ok || old.Indexed == indexed {
+		return nil
+	}
+	rec := *old
+	rec.Indexed = indexed
+	return s.append(walEntry{Op: "put", Record: &rec})
+}
+
+// Delete removes the record for sha1
+func (s *Store) Delete(sha1 string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.records[sha1]; !ok {
+		return nil
+	}
+	return s.append(walEntry{Op: "del", Sha1: sha1})
+}
+
+// Get returns the record for sha1
+func (s *Store) Get(sha1 string) (StoreRecord, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rec, ok := s.records[sha1]
+	if !ok {
+		return StoreRecord{}, false
+	}
+	return *rec, true
+}
+
+// Len returns the number of records
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.records)
+}
+
+// Range calls fn for every record until fn returns false
+func (s *Store) Range(fn func(StoreRecord) bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, rec := range s.records {
+		if !fn(*rec) {
+			return
+		}
+	}
+}
+
+// Compact writes every record to a new snapshot and starts a new write ahead
+// log, changes are only held up while the log is switched
+func (s *Store) Compact() error {
+	s.mu.Lock()
+	if s.wal == nil {
+		s.mu.Unlock()
+		return fmt.Errorf("store is closed")
+	}
+	snap, err := s.rotate(true)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.writeSnapshot(snap)
+}
+
+// rotate closes the write ahead log, starting the next one when next is set,
+// and returns the records the closed logs leave. The caller holds the write
+// lock.
+func (s *Store) rotate(next bool) (*storeSnapshot, error) {
+	var wal *os.File
+	if next {
+		var err error
+		wal, err = os.OpenFile(s.walName(s.gen+1), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("error opening write ahead log: %w", err)
+		}
+	}
+	snap := &storeSnapshot{gen: s.gen, records: make([]*StoreRecord, 0, len(s.records))}
+	for _, rec := range s.records {
+		snap.records = append(snap.records, rec)
+	}
+	s.wal.Close()
+	s.wal = wal
+	s.gen++
+	s.walRecords = 0
+	return snap, nil
+}
+
+// writeSnapshot installs snap and removes the write ahead logs it covers. A
+// snapshot older than the one on disk is dropped.
+func (s *Store) writeSnapshot(snap *storeSnapshot) error {
+	s.snapMu.Lock()
+	defer s.snapMu.Unlock()
+
+	if snap.gen <= s.snapGen {
+		return nil
+	}
+	tmp := filepath.Join(s.dir, STORE_SNAPSHOT+".tmp")
+	file, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("error creating snapshot: %w", err)
+	}
+	defer os.Remove(tmp)
+
+	w := bufio.NewWriter(file)
+	hdr, _ := json.Marshal(snapshotHeader{Gen: snap.gen, Count: len(snap.records)})
+	w.Write(frame(hdr))
+	for _, rec := range snap.records {
+		payload, err := json.Marshal(rec)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		w.Write(frame(payload))
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("error writing snapshot: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("error syncing snapshot: %w", err)
+	}
+	file.Close()
+
+	if err := os.Rename(tmp, filepath.Join(s.dir, STORE_SNAPSHOT)); err != nil {
+		return fmt.Errorf("error installing snapshot: %w", err)
+	}
+	if err := syncDir(s.dir); err != nil {
+		return err
+	}
+	s.snapGen = snap.gen
+
+	// the snapshot covers the logs up to its generation
+	gens, err := s.walGenerations()
+	if err != nil {
+		return err
+	}
+	for _, g := range gens {
+		if g <= snap.gen {
+			os.Remove(s.walName(g))
+		}
+	}
+	return syncDir(s.dir)
+}
+
+// Close compacts the store and closes the write ahead log, it waits for a
+// background compaction
+func (s *Store) Close() error {
+	s.mu.Lock()
+	if s.wal == nil {
+		s.mu.Unlock()
+		return nil
+	}
+	var snap *storeSnapshot
+	var err error
+	if s.walRecords > 0 {
+		snap, err = s.rotate(false)
+	} else {
+		s.wal.Close()
+		s.wal = nil
+	}
+	s.mu.Unlock()
+
+	s.background.Wait()
+	if snap == nil {
+		// nothing changed since the last compaction, did it work?
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		return s.compactErr
+	}
+	if err != nil {
+		return err
+	}
+	return s.writeSnapshot(snap)
+}
+
+// frame prefixes payload with its length and CRC-32C
+func frame(payload []byte) []byte {
+	b := make([]byte, 8+len(payload))
+	binary.LittleEndian.PutUint32(b[0:], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(b[4:], crc32.Checksum(payload, crcTable))
+	copy(b[8:], payload)
+	return b
+}
+
+func readFrame(r io.Reader) ([]byte, error) {
+	var hdr [8]byte
+	n, err := io.ReadFull(r, hdr[:])
+	if err == io.EOF && n == 0 {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	size := binary.LittleEndian.Uint32(hdr[0:])
+	if size > STORE_MAX_FRAME {
+		return nil, fmt.Errorf("record of %d bytes is too large", size)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if crc32.Checksum(payload, crcTable) != binary.LittleEndian.Uint32(hdr[4:]) {
+		return nil, fmt.Errorf("record checksum mismatch")
+	}
+	return payload, nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("error opening store directory: %w", err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("error syncing store directory: %w", err)
+	}
+	return nil
+}
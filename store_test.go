@@ -0,0 +1,236 @@
+package HuntingHash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func storeRecord(i int) StoreRecord {
+	now := time.Date(2025, 1, 1, 0, 0, i, 0, time.UTC)
+	return StoreRecord{
+		Sha1:      fmt.Sprintf("%040x", i),
+		Id:        fmt.Sprintf("id-%d", i),
+		Label:     fmt.Sprintf("file%d", i),
+		Magic:     "data",
+		Len:       int32(1000 + i),
+		FirstSeen: now,
+		LastSeen:  now,
+	}
+}
+
+func openStore(t *testing.T, dir string) *Store {
+	t.Helper()
+	s, err := OpenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func putRecords(t *testing.T, s *Store, from, to int) {
+	t.Helper()
+	for i := from; i < to; i++ {
+		if _, err := s.Put(storeRecord(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// checkRecords fails unless the store holds exactly the records from to to
+func checkRecords(t *testing.T, s *Store, from, to int) {
+	t.Helper()
+	if s.Len() != to-from {
+		t.Fatalf("store holds %d records, want %d", s.Len(), to-from)
+	}
+	for i := from; i < to; i++ {
+		want := storeRecord(i)
+		got, ok := s.Get(want.Sha1)
+		if !ok {
+			t.Fatalf("record %d is missing", i)
+		}
+		if got.Id != want.Id || got.Label != want.Label || got.Len != want.Len || !got.FirstSeen.Equal(want.FirstSeen) {
+			t.Fatalf("record %d is %+v, want %+v", i, got, want)
+		}
+	}
+}
+
+func walFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	names, err := filepath.Glob(filepath.Join(dir, STORE_WAL_PREFIX+"*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func TestStoreReplaysWriteAheadLog(t *testing.T) {
+	dir := t.TempDir()
+	s := openStore(t, dir)
+	s.SyncWrites = false
+	putRecords(t, s, 0, 20)
+	if err := s.Delete(storeRecord(3).Sha1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetIndexed(storeRecord(4).Sha1, true); err != nil {
+		t.Fatal(err)
+	}
+	// a crash, the store is not closed and only the log is on disk
+	if _, err := os.Stat(filepath.Join(dir, STORE_SNAPSHOT)); !os.IsNotExist(err) {
+		t.Fatalf("snapshot written before compaction: %v", err)
+	}
+
+	r := openStore(t, dir)
+	if r.Len() != 19 {
+		t.Fatalf("store holds %d records, want 19", r.Len())
+	}
+	if _, ok := r.Get(storeRecord(3).Sha1); ok {
+		t.Error("deleted record replayed")
+	}
+	if rec, _ := r.Get(storeRecord(4).Sha1); !rec.Indexed {
+		t.Error("record is not indexed after replay")
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// replayed from the snapshot Close wrote
+	r = openStore(t, dir)
+	defer r.Close()
+	if r.Len() != 19 {
+		t.Fatalf("store holds %d records after close, want 19", r.Len())
+	}
+}
+
+func TestStoreTruncatesTornWriteAheadLog(t *testing.T) {
+	dir := t.TempDir()
+	s := openStore(t, dir)
+	putRecords(t, s, 0, 10)
+
+	wals := walFiles(t, dir)
+	if len(wals) != 1 {
+		t.Fatalf("%d write ahead logs, want 1", len(wals))
+	}
+	st, err := os.Stat(wals[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	good := st.Size()
+
+	// the last record was half written when the machine went down
+	putRecords(t, s, 10, 11)
+	if err := os.Truncate(wals[0], good+20); err != nil {
+		t.Fatal(err)
+	}
+
+	r := openStore(t, dir)
+	checkRecords(t, r, 0, 10)
+	if st, err := os.Stat(wals[0]); err != nil || st.Size() != good {
+		t.Fatalf("torn log not cut back to %d bytes: %v %v", good, st.Size(), err)
+	}
+
+	// the log is appended to after the cut
+	putRecords(t, r, 10, 12)
+	r = openStore(t, dir)
+	checkRecords(t, r, 0, 12)
+	r.Close()
+
+	// a torn record in a log that is not the last is corruption
+	s = openStore(t, dir)
+	putRecords(t, s, 12, 13)
+	wal, err := os.OpenFile(s.walName(s.gen), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wal.Write([]byte("torn"))
+	wal.Close()
+	if err := os.WriteFile(s.walName(s.gen+1), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenStore(dir); err == nil {
+		t.Error("store opened with a corrupt log that is not the last")
+	}
+}
+
+func TestStoreCompaction(t *testing.T) {
+	dir := t.TempDir()
+	s := openStore(t, dir)
+	s.SyncWrites = false
+	s.CompactAfter = 10
+
+	// writers carry on while the background compactions write snapshots
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w * 100; i < w*100+100; i++ {
+				if _, err := s.Put(storeRecord(i)); err != nil {
+					t.Error(err)
+					return
+				}
+				s.Get(storeRecord(i).Sha1)
+			}
+		}(w)
+	}
+	wg.Wait()
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if wals := walFiles(t, dir); len(wals) != 1 {
+		t.Errorf("write ahead logs %v left after compaction", wals)
+	}
+
+	// a crash after compaction, the snapshot and the new log are replayed
+	putRecords(t, s, 400, 405)
+	r := openStore(t, dir)
+	checkRecords(t, r, 0, 405)
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if wals := walFiles(t, dir); len(wals) != 0 {
+		t.Errorf("write ahead logs %v left after close", wals)
+	}
+
+	r = openStore(t, dir)
+	defer r.Close()
+	checkRecords(t, r, 0, 405)
+}
+
+func TestStoreMergeKeepsIndexedIdentifiers(t *testing.T) {
+	s := openStore(t, t.TempDir())
+	defer s.Close()
+
+	indexed := storeRecord(1)
+	indexed.Id2, indexed.Indexed = "pyramid-2", true
+	if _, err := s.Put(indexed); err != nil {
+		t.Fatal(err)
+	}
+
+	// hashed again with another filter and not indexed
+	later := storeRecord(1)
+	later.Id, later.Magic, later.Ssdeep = "other-id", "other magic", "3:abc:def"
+	later.LastSeen = later.LastSeen.Add(time.Hour)
+	got, err := s.Put(later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Id != indexed.Id || got.Id2 != indexed.Id2 || got.Magic != indexed.Magic || !got.Indexed {
+		t.Errorf("indexed identifiers replaced: %+v", got)
+	}
+	if got.Ssdeep != later.Ssdeep || !got.LastSeen.Equal(later.LastSeen) {
+		t.Errorf("later sighting not merged: %+v", got)
+	}
+
+	// indexed again, its identifiers replace the old ones and their pyramid
+	later.Indexed = true
+	if got, err = s.Put(later); err != nil {
+		t.Fatal(err)
+	}
+	if got.Id != later.Id || got.Id2 != "" || got.Magic != later.Magic {
+		t.Errorf("indexed sighting did not replace the identifiers: %+v", got)
+	}
+}
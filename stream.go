@@ -0,0 +1,169 @@
+package HuntingHash
+
+//
+// Copyright 2025 (c) By Rick Wesson & Support Intelligence, Inc.
+// Licenced under the RLL 1.0
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"hash"
+	"image"
+	"math"
+	"time"
+
+	"github.com/eciavatta/sdhash"
+	"github.com/glaslos/ssdeep"
+	"github.com/glaslos/tlsh"
+)
+
+const (
+	MAGIC_HEAD_LEN    = 8 << 20  // streams are classified by their head, libmagic examines at most bytes_max (1-7 MiB)
+	STREAM_BUFFER_MAX = 64 << 20 // streams up to this length are kept for ssdeep and sdhash
+)
+
+// HashStream hashes a buffer delivered in chunks, the bytes are mapped onto
+// the curve as they arrive so only the image is held in memory. ssdeep and
+// sdhash need the whole buffer, they are skipped for streams larger than
+// STREAM_BUFFER_MAX.
+type HashStream struct {
+	h       *Hasher
+	label   string
+	length  int64
+	written int64
+	order   int32
+	im      *image.Gray
+	head    []byte // magic is read from the head of the buffer
+	buffer  []byte // the whole buffer when ssdeep or sdhash are wanted
+	sha     hash.Hash
+	tlsh    *tlsh.TLSH
+
+	Options HashOptions // the hasher defaults, may be changed before Sum
+}
+
+// NewStream starts hashing a buffer of length bytes, the length selects the
+// order of the curve so it must be known up front. The image is allocated
+// from the length, it is checked against StreamMax first.
+func (h *Hasher) NewStream(length int64, label string) (*HashStream, error) {
+	if length < BUFFER_LEN_MIN {
+		return nil, fmt.Errorf("buffer length of %d is too small. minum length is %d", length, BUFFER_LEN_MIN)
+	}
+	if max := h.StreamMax(); length > max {
+		return nil, fmt.Errorf("stream of %d bytes is too large, the limit is %d", length, max)
+	}
+	im, order, err := h.Curve.NewImage(length)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &HashStream{
+		h:      h,
+		label:  label,
+		length: length,
+		order:  order,
+		im:     im,
+		sha:    sha1.New(),
+
+		Options: h.HashOptions,
+	}
+	if h.Tlsh {
+		s.tlsh = tlsh.New()
+	}
+	if (h.Ssdeep || h.Sdhash) && length <= STREAM_BUFFER_MAX {
+		s.buffer = make([]byte, 0, length)
+	}
+	return s, nil
+}
+
+// StreamMax returns the length of the longest stream NewStream accepts: what
+// the curve holds, at most MaxStream when it is set
+func (h *Hasher) StreamMax() int64 {
+	max := min(int64(1)<<(2*h.Curve.Order), math.MaxInt32)
+	if h.MaxStream > 0 {
+		max = min(max, h.MaxStream)
+	}
+	return max
+}
+
+// Write maps the next chunk of the buffer onto the curve
+func (s *HashStream) Write(p []byte) (int, error) {
+	if s.written+int64(len(p)) > s.length {
+		return 0, fmt.Errorf("stream is longer than the announced %d bytes", s.length)
+	}
+	s.h.Curve.Plot(s.im, s.written, p)
+	s.written += int64(len(p))
+
+	if n := MAGIC_HEAD_LEN - len(s.head); n > 0 && !s.h.DNA {
+		s.head = append(s.head, p[:min(n, len(p))]...)
+	}
+	s.sha.Write(p)
+	if s.tlsh != nil {
+		s.tlsh.Write(p)
+	}
+	if s.buffer != nil {
+		s.buffer = append(s.buffer, p...)
+	}
+	return len(p), nil
+}
+
+// Written returns the number of bytes received so far
+func (s *HashStream) Written() int64 {
+	return s.written
+}
+
+// Sum completes the stream, it returns the same result HashBytes would
+// for the whole buffer. Only the first MAGIC_HEAD_LEN bytes are classified,
+// more than libmagic reads of a buffer, a classifier looking further may
+// describe a longer stream differently.
+func (s *HashStream) Sum() (res *Result, err error) {
+	if s.written != s.length {
+		return nil, fmt.Errorf("stream ended after %d of %d bytes", s.written, s.length)
+	}
+
+	res = &Result{Label: s.label, Len: int32(s.length), HOrder: s.order}
+
+	start := time.Now()
+	voxel, err := ReduceWith(s.im, VOXEL_SIDE, s.Options.Filter)
+	if err != nil {
+		return nil, err
+	}
+	s.h.timed(STAGE_RESAMPLE, start)
+	if err := s.h.identify(res, s.head, voxel, s.Options.Filter); err != nil {
+		return nil, err
+	}
+	if s.Options.Pyramid {
+		if err := s.h.pyramid(res, s.im, s.Options.Filter); err != nil {
+			return nil, err
+		}
+	}
+	res.Sha1 = fmt.Sprintf("%40x", s.sha.Sum(nil))
+
+	if s.h.Ssdeep && s.buffer != nil && s.length > 4096 {
+		start := time.Now()
+		sd, err := ssdeep.FuzzyBytes(s.buffer)
+		if err != nil {
+			sd = err.Error()
+		}
+		res.Ssdeep = sd
+		s.h.timed(STAGE_SSDEEP, start)
+	}
+
+	if s.h.Sdhash && s.buffer != nil {
+		start := time.Now()
+		f, err := sdhash.CreateSdbfFromBytes(s.buffer)
+		if err == nil {
+			res.Sdhash = f.Compute().String()
+		}
+		s.h.timed(STAGE_SDHASH, start)
+	}
+
+	// the chunks were fed to TLSH as they arrived, only the digest is timed
+	if s.tlsh != nil && s.length > 256 {
+		start := time.Now()
+		s.tlsh.Sum(nil)
+		res.Tlsh = s.tlsh.String()
+		s.h.timed(STAGE_TLSH, start)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,162 @@
+package HuntingHash
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestStreamMatchesHashBytes(t *testing.T) {
+	curve, err := NewComputedHilbertCurve(12, CURVE_GRAY, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewClassifierHasher(curve, NewSignatureClassifier())
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Ssdeep, h.Tlsh, h.Pyramid = true, true, true
+
+	r := rand.New(rand.NewSource(7))
+	for _, n := range []int{BUFFER_LEN_MIN, 5000, 1 << 20, MAGIC_HEAD_LEN + 12345} {
+		// an ELF head so the classifier has something to say
+		buffer := make([]byte, n)
+		r.Read(buffer)
+		copy(buffer, "\x7fELF\x02\x01\x01")
+
+		want, err := h.HashBytes(buffer, "label")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, chunk := range []int{1000, 1 << 20} {
+			s, err := h.NewStream(int64(n), "label")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for rest := buffer; len(rest) > 0; rest = rest[min(chunk, len(rest)):] {
+				if _, err := s.Write(rest[:min(chunk, len(rest))]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := s.Sum()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != *want {
+				t.Errorf("%d bytes in chunks of %d: stream gives\n%+v\nHashBytes gives\n%+v", n, chunk, got, want)
+			}
+		}
+	}
+}
+
+func TestStreamLengthIsChecked(t *testing.T) {
+	curve, err := NewComputedHilbertCurve(6, CURVE_GRAY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewClassifierHasher(curve, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, n := range []int64{BUFFER_LEN_MIN - 1, 1<<12 + 1, 1 << 40} {
+		if _, err := h.NewStream(n, ""); err == nil {
+			t.Errorf("stream of %d bytes accepted by a curve of order 6", n)
+		}
+	}
+	h.MaxStream = 1000
+	if _, err := h.NewStream(1001, ""); err == nil {
+		t.Errorf("stream of 1001 bytes accepted with MaxStream 1000")
+	}
+
+	s, err := h.NewStream(1000, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Write(make([]byte, 999)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Sum(); err == nil {
+		t.Error("stream summed before its last byte")
+	}
+	if _, err := s.Write(bytes.Repeat([]byte{1}, 2)); err == nil {
+		t.Error("stream accepted bytes past its length")
+	}
+}
+
+// lengthClassifier records the length of the last buffer it classified
+type lengthClassifier struct {
+	last int
+}
+
+func (c *lengthClassifier) Classify(buffer []byte) (string, error) {
+	c.last = len(buffer)
+	return "data", nil
+}
+
+func (c *lengthClassifier) Name() string { return "length" }
+func (c *lengthClassifier) Close() error { return nil }
+
+func TestStreamClassifiesTheHead(t *testing.T) {
+	curve, err := NewComputedHilbertCurve(12, CURVE_GRAY, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffer := make([]byte, MAGIC_HEAD_LEN+12345)
+	rand.New(rand.NewSource(8)).Read(buffer)
+	copy(buffer, "\x7fELF\x02\x01\x01")
+
+	// HashBytes classifies the whole buffer, a stream its head
+	c := new(lengthClassifier)
+	h, err := NewClassifierHasher(curve, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.HashBytes(buffer, ""); err != nil {
+		t.Fatal(err)
+	}
+	if c.last != len(buffer) {
+		t.Errorf("HashBytes classified %d of %d bytes", c.last, len(buffer))
+	}
+	if _, err := streamOf(t, h, buffer).Sum(); err != nil {
+		t.Fatal(err)
+	}
+	if c.last != MAGIC_HEAD_LEN {
+		t.Errorf("stream classified %d bytes, want %d", c.last, MAGIC_HEAD_LEN)
+	}
+
+	// libmagic reads less than the head, both give the same identifier
+	h, err = NewHasher(curve, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	want, err := h.HashBytes(buffer, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := streamOf(t, h, buffer).Sum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Id != want.Id || got.Magic != want.Magic {
+		t.Errorf("stream gives %s %q, HashBytes %s %q", got.Id, got.Magic, want.Id, want.Magic)
+	}
+}
+
+// streamOf writes buffer to a new stream of h in 1 MiB chunks
+func streamOf(t *testing.T, h *Hasher, buffer []byte) *HashStream {
+	t.Helper()
+
+	s, err := h.NewStream(int64(len(buffer)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rest := buffer; len(rest) > 0; rest = rest[min(1<<20, len(rest)):] {
+		if _, err := s.Write(rest[:min(1<<20, len(rest))]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}